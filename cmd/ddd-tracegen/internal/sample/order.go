@@ -0,0 +1,50 @@
+// Package sample 是 ddd-tracegen 生成代码的示例，同时用于对比反射与生成代码的结果和性能
+package sample
+
+import (
+	"time"
+
+	"github.com/zhenyu888/ddd-core/ddd"
+)
+
+//go:generate go run github.com/zhenyu888/ddd-core/cmd/ddd-tracegen -type=Order
+
+type OrderStatus int8
+
+type Address struct {
+	City   string `json:"city"`
+	Street string `json:"street"`
+	Zip    string `json:"zip"`
+}
+
+type OrderLine struct {
+	Sku      string  `json:"sku"`
+	Quantity int     `json:"quantity"`
+	Price    float64 `json:"price"`
+}
+
+// Operator 匿名嵌入时在 json 中被展开
+type Operator struct {
+	UpdatedBy string `json:"updatedBy"`
+}
+
+type Order struct {
+	ddd.AggregateManager
+	Operator
+	Id         int64             `json:"id"`
+	CustomerId int64             `json:"customerId"`
+	Remark     string            `json:"remark"`
+	Status     OrderStatus       `json:"status" trace:"status"`
+	CreateTime time.Time         `json:"createTime"`
+	Address    Address           `json:"address" trace:"address,deep"`
+	Lines      []OrderLine       `json:"lines" trace:"lines,key=sku"`
+	Tags       []string          `json:"tags" trace:"tags"`
+	Attributes map[string]string `json:"attributes" trace:"attributes"`
+	Extra      interface{}       `json:"extra"`
+	Secret     string            `json:"-"`
+	Notes      []string          `json:"-" trace:"notes"`
+}
+
+func (o *Order) AggregateId() int64 {
+	return o.Id
+}
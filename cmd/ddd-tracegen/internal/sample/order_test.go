@@ -0,0 +1,177 @@
+package sample
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zhenyu888/ddd-core/ddd"
+	"github.com/zhenyu888/ddd-core/diff"
+	"github.com/zhenyu888/ddd-core/funcs"
+)
+
+// reflectOrder 与 Order 字段相同但没有生成的方法，ddd.Trace 对它走反射
+type reflectOrder Order
+
+func (o *reflectOrder) AggregateId() int64 {
+	return o.Id
+}
+
+func newOrder(lines int) *Order {
+	o := &Order{
+		Id:         1,
+		CustomerId: 100,
+		Remark:     "remark",
+		Status:     1,
+		CreateTime: time.Now(),
+		Address:    Address{City: "Hangzhou", Street: "Wensan Rd", Zip: "310000"},
+		Tags:       []string{"vip", "gift", "express"},
+		Attributes: map[string]string{"channel": "app", "source": "ads"},
+	}
+	for i := 0; i < lines; i++ {
+		o.Lines = append(o.Lines, OrderLine{Sku: fmt.Sprintf("sku-%d", i), Quantity: i + 1, Price: float64(i) * 1.5})
+	}
+	return o
+}
+
+// modify 在 o 的副本上做一组典型的改动，覆盖所有 tag 选项
+func modify(o *Order) *Order {
+	cur := o.CopySnapshot().(*Order)
+	cur.Remark = "changed"
+	cur.Status = 2
+	cur.CreateTime = cur.CreateTime.Add(time.Hour)
+	cur.Address.City = "Shanghai"
+	cur.Lines[0].Quantity = 99
+	cur.Lines = append(cur.Lines[1:], OrderLine{Sku: "sku-new", Quantity: 1})
+	cur.Tags = []string{"express", "vip", "new"}
+	cur.Attributes["channel"] = "web"
+	cur.Attributes["coupon"] = "x"
+	delete(cur.Attributes, "source")
+	cur.Extra = "extra"
+	cur.UpdatedBy = "admin"
+	cur.Secret = "secret"
+	cur.Notes = []string{"note"}
+	return cur
+}
+
+func TestCopySnapshotParity(t *testing.T) {
+	o := newOrder(10)
+	generated := o.CopySnapshot().(*Order)
+	reflected := funcs.DeepCopy(o).(*Order)
+	if !reflect.DeepEqual(generated, reflected) {
+		t.Fatalf("CopySnapshot = %+v, DeepCopy = %+v", generated, reflected)
+	}
+	generated.Lines[0].Quantity = -1
+	generated.Tags[0] = "changed"
+	generated.Attributes["channel"] = "changed"
+	if reflect.DeepEqual(generated, o) {
+		t.Fatal("CopySnapshot shares memory with the original")
+	}
+}
+
+func TestCopySnapshotNilInterface(t *testing.T) {
+	o := newOrder(1)
+	o.Attach(o)
+	if o.Snapshot().(*Order).Extra != nil {
+		t.Fatal("nil interface field should stay nil")
+	}
+}
+
+func TestTraceDiffParity(t *testing.T) {
+	base := newOrder(10)
+	cur := modify(base)
+
+	generated := ddd.Trace(cur, base)
+	reflected := ddd.Trace((*reflectOrder)(cur), (*reflectOrder)(base))
+	if _, ok := interface{}((*reflectOrder)(cur)).(ddd.DiffTracer); ok {
+		t.Fatal("reflectOrder should not implement DiffTracer")
+	}
+
+	if !reflect.DeepEqual(generated.Changes(), reflected.Changes()) {
+		t.Fatalf("Changes() differ:\ngenerated %+v\nreflected %+v", generated.Changes(), reflected.Changes())
+	}
+	if generated.IsSelfChanged() != reflected.IsSelfChanged() {
+		t.Fatal("IsSelfChanged() differs")
+	}
+	for _, name := range reflected.DiffNames() {
+		if !reflect.DeepEqual(generated.GetDiff(name).Changes(), reflected.GetDiff(name).Changes()) {
+			t.Fatalf("GetDiff(%q) differs", name)
+		}
+	}
+	for _, name := range reflected.ListDiffNames() {
+		g, r := generated.GetListDiff(name), reflected.GetListDiff(name)
+		if !reflect.DeepEqual(g.Operations(), r.Operations()) || !reflect.DeepEqual(g.Added(), r.Added()) ||
+			!reflect.DeepEqual(g.Removed(), r.Removed()) || !reflect.DeepEqual(g.Modified(), r.Modified()) ||
+			!reflect.DeepEqual(g.ModifiedOld(), r.ModifiedOld()) {
+			t.Fatalf("GetListDiff(%q) differs", name)
+		}
+		if len(g.ModifiedOld()) != len(g.Modified()) {
+			t.Fatalf("GetListDiff(%q) modified %d elements but recorded %d old values", name, len(g.Modified()), len(g.ModifiedOld()))
+		}
+	}
+	for _, name := range reflected.MapDiffNames() {
+		g, r := generated.GetMapDiff(name), reflected.GetMapDiff(name)
+		if !reflect.DeepEqual(g.Added(), r.Added()) || !reflect.DeepEqual(g.Removed(), r.Removed()) ||
+			!reflect.DeepEqual(g.Modified(), r.Modified()) {
+			t.Fatalf("GetMapDiff(%q) differs", name)
+		}
+	}
+	if len(generated.Changes()) == 0 {
+		t.Fatal("expected changes")
+	}
+	if ld := generated.GetListDiff("attributes"); len(ld.Added()) != 1 || len(ld.Removed()) != 1 || len(ld.Modified()) != 1 {
+		t.Fatalf("GetListDiff on a map tag = %+v", ld)
+	}
+}
+
+func TestTraceDiffJSONPath(t *testing.T) {
+	base := newOrder(3)
+	cur := modify(base)
+	hidden := map[string]bool{}
+	for _, change := range ddd.Trace(cur, base).Changes() {
+		hidden[change.Path] = change.Hidden
+	}
+	if v, ok := hidden["updatedBy"]; !ok || v {
+		t.Fatalf("embedded field should be traced by its json path, got %v", hidden)
+	}
+	if !hidden["Secret"] || !hidden["Notes"] {
+		t.Fatalf("json:\"-\" fields should be hidden, got %v", hidden)
+	}
+	if _, err := diff.ToJSONPatch(ddd.Trace(cur, base)); !errors.Is(err, diff.ErrDiffPathHidden) {
+		t.Fatalf("ToJSONPatch err = %v, want ErrDiffPathHidden", err)
+	}
+}
+
+func BenchmarkCopySnapshot(b *testing.B) {
+	o := newOrder(50)
+	b.Run("reflect", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = funcs.DeepCopy(o)
+		}
+	})
+	b.Run("generated", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = o.CopySnapshot()
+		}
+	})
+}
+
+func BenchmarkTrace(b *testing.B) {
+	base := newOrder(50)
+	cur := modify(base)
+	var d diff.AggregateDiff
+	b.Run("reflect", func(b *testing.B) {
+		x, y := (*reflectOrder)(cur), (*reflectOrder)(base)
+		for i := 0; i < b.N; i++ {
+			d = ddd.Trace(x, y)
+		}
+	})
+	b.Run("generated", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			d = ddd.Trace(cur, base)
+		}
+	})
+	_ = d
+}
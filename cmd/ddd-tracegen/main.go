@@ -0,0 +1,423 @@
+// ddd-tracegen 为聚合根生成不依赖反射的快照复制和改动对比代码
+//
+// 在聚合根所在的文件中添加：
+//
+//	//go:generate ddd-tracegen -type=Order
+//
+// 执行 go generate 后生成 order_trace.go，其中 (*Order).CopySnapshot 被 AggregateManager.Attach 用于复制快照，
+// (*Order).TraceDiff 被 ddd.Trace 用于对比，trace tag 的含义与 ddd.Trace 一致。
+// 基础类型的字段直接比较，其他字段仍通过 ddd.TraceField/TraceList/TraceMap 对比。
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	generatedHeader = "// Code generated by ddd-tracegen. DO NOT EDIT."
+	dddPath         = "github.com/zhenyu888/ddd-core/ddd"
+	diffPath        = "github.com/zhenyu888/ddd-core/diff"
+	funcsPath       = "github.com/zhenyu888/ddd-core/funcs"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of aggregate type names; must be set")
+	output    = flag.String("output", "", "output file name; default <type>_trace.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of ddd-tracegen:\n")
+	fmt.Fprintf(os.Stderr, "\tddd-tracegen -type T [directory]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ddd-tracegen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if args := flag.Args(); len(args) > 0 {
+		dir = args[0]
+	}
+
+	pkg, err := loadPackage(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	names := strings.Split(*typeNames, ",")
+	if *output != "" {
+		writeFile(filepath.Join(dir, *output), pkg, names)
+		return
+	}
+	for _, name := range names {
+		writeFile(filepath.Join(dir, strings.ToLower(name)+"_trace.go"), pkg, []string{name})
+	}
+}
+
+func writeFile(name string, pkg *types.Package, typeNames []string) {
+	g := newGenerator(pkg)
+	for _, typeName := range typeNames {
+		if err := g.generate(typeName); err != nil {
+			log.Fatal(err)
+		}
+	}
+	src, err := g.source()
+	if err != nil {
+		log.Fatalf("format %s: %v", name, err)
+	}
+	if err = os.WriteFile(name, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// loadPackage 类型检查 dir 中的包，忽略之前生成的文件，避免字段改动后旧代码无法通过检查
+func loadPackage(dir string) (*types.Package, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("%d packages found in %s", len(pkgs), dir)
+	}
+	var files []*ast.File
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			if isGenerated(file) {
+				continue
+			}
+			files = append(files, file)
+		}
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		// 只需要结构体的定义，忽略其他错误
+		Error: func(err error) {},
+	}
+	pkg, _ := conf.Check(files[0].Name.Name, fset, files, nil)
+	if pkg == nil {
+		return nil, fmt.Errorf("type check %s failed", dir)
+	}
+	return pkg, nil
+}
+
+func isGenerated(file *ast.File) bool {
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			if comment.Text == generatedHeader {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type generator struct {
+	pkg     *types.Package
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+func newGenerator(pkg *types.Package) *generator {
+	return &generator{pkg: pkg, imports: make(map[string]bool)}
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// qualifier 返回引用 path 包时的前缀，生成在 ddd 包内时为空
+func (g *generator) qualifier(path string) string {
+	if g.pkg.Path() == path {
+		return ""
+	}
+	g.imports[path] = true
+	return path[strings.LastIndex(path, "/")+1:] + "."
+}
+
+func (g *generator) source() ([]byte, error) {
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "%s\n\npackage %s\n\n", generatedHeader, g.pkg.Name())
+	if len(g.imports) > 0 {
+		paths := make([]string, 0, len(g.imports))
+		for path := range g.imports {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		head.WriteString("import (\n")
+		for _, path := range paths {
+			fmt.Fprintf(&head, "\t%q\n", path)
+		}
+		head.WriteString(")\n\n")
+	}
+	head.Write(g.buf.Bytes())
+	return format.Source(head.Bytes())
+}
+
+// field 聚合根中参与快照和对比的字段
+type field struct {
+	name    string
+	path    string
+	tagName string
+	options string
+	typ     types.Type
+	// hidden json:"-" 的字段，改动标记为 Hidden
+	hidden bool
+}
+
+type fieldKind int8
+
+const (
+	kindOther fieldKind = iota
+	kindBasic           // 布尔、数字、字符串，可以直接比较和赋值
+	kindSlice
+	kindArray
+	kindMap
+)
+
+func kindOf(t types.Type) fieldKind {
+	switch u := t.Underlying().(type) {
+	case *types.Slice:
+		return kindSlice
+	case *types.Array:
+		return kindArray
+	case *types.Map:
+		return kindMap
+	case *types.Basic:
+		if u.Info()&types.IsUntyped == 0 && u.Kind() != types.UnsafePointer {
+			return kindBasic
+		}
+	}
+	return kindOther
+}
+
+func (g *generator) generate(typeName string) error {
+	obj := g.pkg.Scope().Lookup(typeName)
+	if obj == nil {
+		return fmt.Errorf("type %s not found in package %s", typeName, g.pkg.Name())
+	}
+	st, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return fmt.Errorf("type %s is not a struct", typeName)
+	}
+	var fields []field
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		// 与 ddd.Trace 一样跳过未导出的字段和 AggregateManager/MixModel
+		if !v.Exported() || v.Name() == "AggregateManager" || v.Name() == "MixModel" {
+			continue
+		}
+		tag := reflect.StructTag(st.Tag(i))
+		tagName, options := parseTag(tag.Get("trace"))
+		if tagName == "-" {
+			continue
+		}
+		fields = append(fields, field{
+			name:    v.Name(),
+			path:    fieldPath(v, tag),
+			tagName: tagName,
+			options: options,
+			typ:     v.Type(),
+			hidden:  tag.Get("json") == "-",
+		})
+	}
+	g.generateCopy(typeName, st)
+	g.generateDiff(typeName, fields)
+	return nil
+}
+
+func (g *generator) generateCopy(typeName string, st *types.Struct) {
+	ddd := g.qualifier(dddPath)
+	g.printf("// CopySnapshot 复制 %s 的快照，只复制导出的字段\n", typeName)
+	g.printf("func (a *%s) CopySnapshot() %sAggregate {\n", typeName, ddd)
+	g.printf("cp := &%s{}\n", typeName)
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		if !v.Exported() || v.Name() == "AggregateManager" {
+			continue
+		}
+		name := v.Name()
+		switch t := v.Type().Underlying().(type) {
+		case *types.Slice:
+			if isFlat(t.Elem()) {
+				g.printf("if a.%s != nil {\ncp.%s = append(a.%s[:0:0], a.%s...)\n}\n", name, name, name, name)
+				continue
+			}
+		case *types.Map:
+			if isFlat(t.Key()) && isFlat(t.Elem()) {
+				g.printf("cp.%s = %sCopyMap(a.%s)\n", name, g.qualifier(funcsPath), name)
+				continue
+			}
+		default:
+			if isFlat(v.Type()) {
+				g.printf("cp.%s = a.%s\n", name, name)
+				continue
+			}
+		}
+		g.printf("cp.%s = %sDeepCopyOf(a.%s)\n", name, g.qualifier(funcsPath), name)
+	}
+	g.printf("return cp\n}\n\n")
+}
+
+// isFlat 类型不包含引用且所有字段都导出，直接赋值与 funcs.DeepCopy 的结果相同
+func isFlat(t types.Type) bool {
+	if named, ok := t.(*types.Named); ok && named.Obj().Pkg() != nil &&
+		named.Obj().Pkg().Path() == "time" && named.Obj().Name() == "Time" {
+		return true
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return kindOf(u) == kindBasic
+	case *types.Array:
+		return isFlat(u.Elem())
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if !u.Field(i).Exported() || !isFlat(u.Field(i).Type()) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (g *generator) generateDiff(typeName string, fields []field) {
+	ddd := g.qualifier(dddPath)
+	d := g.qualifier(diffPath)
+	g.printf("// TraceDiff 对比 %s 与快照，结果与 ddd.Trace 相同\n", typeName)
+	g.printf("func (a *%s) TraceDiff(snapshot %sAggregate) %sAggregateDiff {\n", typeName, ddd, d)
+	g.printf("builder := %sNewAggregateDiffBuilder()\n", d)
+	g.printf("s, ok := snapshot.(*%s)\n", typeName)
+	g.printf("if !ok || s == nil {\nbuilder.SetSelfChanged(true)\nreturn builder.Build()\n}\n")
+
+	// slice 和 map 类型的字段按 tag 分组，最后单独处理
+	sliceFields := make(map[string][]field)
+	mapFields := make(map[string][]field)
+	var listTags []string
+	for _, f := range fields {
+		if !isValidTag(f.tagName) {
+			g.generateChange(f, "builder.AppendSelfChange(change)")
+			continue
+		}
+		// 与 ddd.Trace 一样，json 中不存在的 slice/map 字段整体对比
+		switch kind := kindOf(f.typ); {
+		case f.hidden:
+			g.generateChange(f, fmt.Sprintf("builder.AppendChange(%q, change)", f.tagName))
+			continue
+		case kind == kindSlice, kind == kindArray:
+			sliceFields[f.tagName] = append(sliceFields[f.tagName], f)
+		case kind == kindMap:
+			mapFields[f.tagName] = append(mapFields[f.tagName], f)
+		default:
+			g.generateChange(f, fmt.Sprintf("builder.AppendChange(%q, change)", f.tagName))
+			continue
+		}
+		if len(sliceFields[f.tagName])+len(mapFields[f.tagName]) == 1 {
+			listTags = append(listTags, f.tagName)
+		}
+	}
+	for _, tagName := range listTags {
+		slices, maps := sliceFields[tagName], mapFields[tagName]
+		switch {
+		case len(slices) == 1 && len(maps) == 0:
+			f := slices[0]
+			g.printf("builder.PutListDiff(%q, %sTraceList(%q, a.%s, s.%s, %q))\n", tagName, ddd, f.path, f.name, f.name, f.options)
+		case len(slices) == 0 && len(maps) == 1:
+			f := maps[0]
+			g.printf("builder.PutMapDiff(%q, %sTraceMap(%q, a.%s, s.%s))\n", tagName, ddd, f.path, f.name, f.name)
+		default:
+			// 同一个 tag 下有多个 slice/map 字段时整体对比
+			for _, f := range append(slices, maps...) {
+				f.options = ""
+				g.generateChange(f, fmt.Sprintf("builder.AppendChange(%q, change)", tagName))
+			}
+		}
+	}
+	g.printf("return builder.Build()\n}\n\n")
+}
+
+// generateChange 基础类型直接比较，其他类型通过 ddd.TraceField 比较
+func (g *generator) generateChange(f field, appendStmt string) {
+	d := g.qualifier(diffPath)
+	if kindOf(f.typ) == kindBasic {
+		path := f.path
+		if path == "" {
+			path = typeName(f.typ)
+		}
+		g.printf("if !%sEqualComparable(a.%s, s.%s) {\n", d, f.name, f.name)
+		if f.hidden {
+			g.printf("change := %sFieldChange{Path: %q, OldValue: s.%s, NewValue: a.%s, Hidden: true}\n", d, path, f.name, f.name)
+		} else {
+			g.printf("change := %sFieldChange{Path: %q, OldValue: s.%s, NewValue: a.%s}\n", d, path, f.name, f.name)
+		}
+		g.printf("%s\n}\n", appendStmt)
+		return
+	}
+	g.printf("for _, change := range %sTraceField(%q, a.%s, s.%s, %q) {\n", g.qualifier(dddPath), f.path, f.name, f.name, f.options)
+	if f.hidden {
+		g.printf("change.Hidden = true\n")
+	}
+	g.printf("%s\n}\n", appendStmt)
+}
+
+func typeName(t types.Type) string {
+	if named, ok := t.(*types.Named); ok {
+		return named.Obj().Name()
+	}
+	return t.String()
+}
+
+// fieldPath 与 ddd 中的字段路径一致：优先使用 json tag 名，匿名嵌入且没有 json tag 的字段为空
+func fieldPath(v *types.Var, tag reflect.StructTag) string {
+	name, _ := parseTag(tag.Get("json"))
+	if name == "" || tag.Get("json") == "-" {
+		if v.Anonymous() {
+			return ""
+		}
+		name = v.Name()
+	}
+	return name
+}
+
+func parseTag(tag string) (string, string) {
+	if idx := strings.Index(tag, ","); idx != -1 {
+		return tag[:idx], tag[idx+1:]
+	}
+	return tag, ""
+}
+
+func isValidTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c):
+		case !unicode.IsLetter(c) && !unicode.IsDigit(c):
+			return false
+		}
+	}
+	return true
+}
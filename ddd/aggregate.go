@@ -1,7 +1,7 @@
 package ddd
 
 import (
-	"fmt"
+	"context"
 	"time"
 
 	"github.com/zhenyu888/ddd-core/diff"
@@ -35,6 +35,12 @@ type AggregateRoot interface {
 type AggregateManager struct {
 	events   []DomainEvent
 	snapshot Aggregate
+	idGen    EventIdGenerator
+}
+
+// SetEventIdGenerator 为当前聚合指定事件 id 生成器，未指定时使用默认生成器
+func (a *AggregateManager) SetEventIdGenerator(idGen EventIdGenerator) {
+	a.idGen = idGen
 }
 
 func (a *AggregateManager) IsZero(aggregate Aggregate) bool {
@@ -44,15 +50,33 @@ func (a *AggregateManager) IsZero(aggregate Aggregate) bool {
 func (a *AggregateManager) RaiseEvent(event DomainEvent) {
 	if setter, ok := event.(DomainEventSetter); ok {
 		if event.GetEventId() == "" {
-			setter.SetEventId(fmt.Sprintf("DomainEvent:%s-%d", funcs.Base64(event.String()), time.Now().UnixNano()))
+			setter.SetEventId(a.nextEventId())
 		}
 		if event.GetOccurredOn() <= 0 {
 			setter.SetOccurredOn(time.Now().Unix())
 		}
 	}
+	// 快照是修改前的状态，聚合的 id、类型、版本在仓储保存时按当前的聚合根补全
+	fillAggregateMetadata(event, nil)
 	a.events = append(a.events, event)
 }
 
+func (a *AggregateManager) nextEventId() string {
+	idGen := a.idGen
+	if idGen == nil {
+		idGen = getDefaultEventIdGenerator()
+	}
+	id, err := idGen.NextEventId(context.Background())
+	if err != nil && idGen != defaultULIDGenerator {
+		// 自定义生成器失败时退回到 ULID，RaiseEvent 不能返回错误
+		id, err = defaultULIDGenerator.NextEventId(context.Background())
+	}
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
 func (a *AggregateManager) Events() []DomainEvent {
 	return a.events
 }
@@ -72,6 +96,10 @@ func (a *AggregateManager) Attach(aggregate Aggregate) {
 		return
 	}
 	if a.snapshot == nil || aggregate.AggregateId() == a.snapshot.AggregateId() {
+		if copier, ok := aggregate.(SnapshotCopier); ok {
+			a.snapshot = copier.CopySnapshot()
+			return
+		}
 		copied := funcs.DeepCopy(aggregate)
 		if agg, ok := copied.(Aggregate); ok {
 			a.snapshot = agg
@@ -0,0 +1,135 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/zhenyu888/ddd-core/diff"
+)
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+)
+
+// AuditRecord 一次保存中聚合根的改动
+type AuditRecord struct {
+	AggregateType string
+	AggregateId   int64
+	Action        string
+	Actor         string
+	CorrelationId string
+	Changes       []diff.FieldChange
+	OccurredOn    time.Time
+}
+
+// AuditSink 审计记录的存储
+type AuditSink interface {
+	Write(ctx context.Context, record AuditRecord) error
+}
+
+// newAuditRecord 由聚合根的改动生成审计记录，没有改动时返回 false
+// 没有快照时视为新建，不管 ad 是什么都与零值对比得到所有字段的初始值
+func newAuditRecord(ctx context.Context, root AggregateRoot, ad diff.AggregateDiff) (AuditRecord, bool) {
+	action := AuditActionUpdate
+	if snapshot := root.Snapshot(); snapshot == nil {
+		action = AuditActionCreate
+		zero, _ := reflect.New(reflect.TypeOf(root).Elem()).Interface().(Aggregate)
+		ad = Trace(root, zero)
+	} else if ad == nil {
+		ad = Trace(root, snapshot)
+	}
+	changes := auditChanges(ad)
+	if len(changes) == 0 {
+		return AuditRecord{}, false
+	}
+	return AuditRecord{
+		AggregateType: AggregateTypeName(root),
+		AggregateId:   root.AggregateId(),
+		Action:        action,
+		Actor:         ActorFromContext(ctx),
+		CorrelationId: CorrelationIdFromContext(ctx),
+		Changes:       changes,
+		OccurredOn:    time.Now(),
+	}, true
+}
+
+// auditChanges 把 AggregateDiff 展开成字段改动：
+// map 的每个 key 记为 path.key；slice 新增的元素只有 NewValue，删除的只有 OldValue，修改的同时记录新旧值
+func auditChanges(ad diff.AggregateDiff) []diff.FieldChange {
+	rlt := ad.Changes()
+	for _, name := range ad.ListDiffNames() {
+		ld := ad.GetListDiff(name)
+		for _, v := range ld.Added() {
+			rlt = append(rlt, diff.FieldChange{Path: ld.Path(), NewValue: v})
+		}
+		for _, v := range ld.Removed() {
+			rlt = append(rlt, diff.FieldChange{Path: ld.Path(), OldValue: v})
+		}
+		olds := ld.ModifiedOld()
+		for i, v := range ld.Modified() {
+			change := diff.FieldChange{Path: ld.Path(), NewValue: v}
+			if i < len(olds) {
+				change.OldValue = olds[i]
+			}
+			rlt = append(rlt, change)
+		}
+	}
+	for _, name := range ad.MapDiffNames() {
+		md := ad.GetMapDiff(name)
+		for _, entries := range [][]diff.MapEntry{md.Added(), md.Removed(), md.Modified()} {
+			for _, entry := range entries {
+				path := fmt.Sprintf("%s.%v", md.Path(), entry.Key)
+				rlt = append(rlt, diff.FieldChange{Path: path, OldValue: entry.Old, NewValue: entry.New})
+			}
+		}
+	}
+	return rlt
+}
+
+type AuditLogRecord struct {
+	Id            int64  `gorm:"primaryKey;autoIncrement"`
+	AggregateType string `gorm:"size:128;index:idx_ddd_audit_aggregate"`
+	AggregateId   int64  `gorm:"index:idx_ddd_audit_aggregate"`
+	Action        string `gorm:"size:16"`
+	Actor         string `gorm:"size:128;index"`
+	CorrelationId string `gorm:"size:64"`
+	Changes       []byte
+	OccurredOn    time.Time `gorm:"index"`
+}
+
+func (AuditLogRecord) TableName() string {
+	return "ddd_audit_log"
+}
+
+type GormAuditSink struct {
+	factory DBFactory
+}
+
+// NewGormAuditSink ctx 在事务中时审计记录与聚合根在同一个事务中提交或回滚
+func NewGormAuditSink(factory DBFactory) *GormAuditSink {
+	return &GormAuditSink{factory: factory}
+}
+
+func (s *GormAuditSink) Write(ctx context.Context, record AuditRecord) error {
+	changes, err := json.Marshal(record.Changes)
+	if err != nil {
+		return err
+	}
+	db, err := lookupWriteDB(ctx, s.factory)
+	if err != nil {
+		return err
+	}
+	return db.Create(&AuditLogRecord{
+		AggregateType: record.AggregateType,
+		AggregateId:   record.AggregateId,
+		Action:        record.Action,
+		Actor:         record.Actor,
+		CorrelationId: record.CorrelationId,
+		Changes:       changes,
+		OccurredOn:    record.OccurredOn,
+	}).Error
+}
@@ -3,6 +3,9 @@ package ddd
 import (
 	"context"
 	"fmt"
+	"log"
+	"sync"
+	"time"
 
 	"github.com/zhenyu888/ddd-core/ebus"
 )
@@ -47,41 +50,250 @@ func (p *ebusPublisher) Publish(ctx context.Context, event DomainEvent) error {
 type DomainEventSubscriber func(context.Context, DomainEvent)
 
 type dddEventHandler struct {
-	id    string
-	fn    DomainEventSubscriber
-	async bool
+	id        string
+	fn        DomainEventSubscriber
+	replayFn  DomainEventSubscriber
+	async     bool
+	accept    func(DomainEvent) bool
+	timeout   time.Duration
+	predicate ebus.Predicate
+	dedup     IdempotencyStore
+	txManager *TransactionManager
+	onError   AsyncErrorHandler
+}
+
+type SubscriberOption func(*dddEventHandler)
+
+// WithHandlerTimeout 设置异步订阅者单次处理的超时时间，同步订阅者沿用调用方的 context
+func WithHandlerTimeout(timeout time.Duration) SubscriberOption {
+	return func(e *dddEventHandler) {
+		e.timeout = timeout
+	}
+}
+
+// WithEventFilter 注册时声明事件过滤条件，可以用 ebus.And/Or/Not/FieldEquals 等组合
+func WithEventFilter(predicate ebus.Predicate) SubscriberOption {
+	return func(e *dddEventHandler) {
+		if e.predicate == nil {
+			e.predicate = predicate
+		} else {
+			e.predicate = ebus.And(e.predicate, predicate)
+		}
+	}
+}
+
+// WithIdempotency 按事件 id 去重，同一个事件对该订阅者只处理一次
+// 使用 GormIdempotencyStore 时必须同时使用 WithTransaction，否则 Claim 返回错误，事件不去重直接处理
+func WithIdempotency(store IdempotencyStore) SubscriberOption {
+	return func(e *dddEventHandler) {
+		e.dedup = store
+	}
+}
+
+// WithErrorHandler 异步订阅者 panic 或者超时时回调，默认使用 SetAsyncErrorHandler 设置的回调
+func WithErrorHandler(fn AsyncErrorHandler) SubscriberOption {
+	return func(e *dddEventHandler) {
+		if fn != nil {
+			e.onError = fn
+		}
+	}
+}
+
+// WithTransaction 在事务中执行订阅者，panic 时回滚，配合 GormIdempotencyStore 可以保证去重记录与业务写入的原子性
+func WithTransaction(manager *TransactionManager) SubscriberOption {
+	return func(e *dddEventHandler) {
+		e.txManager = manager
+	}
+}
+
+func newEventHandler(id string, fn DomainEventSubscriber, async bool, opts []SubscriberOption) *dddEventHandler {
+	e := &dddEventHandler{
+		id:      id,
+		fn:      fn,
+		async:   async,
+		onError: handleAsyncError,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	// 重放是为了重新处理历史事件，不做去重
+	e.replayFn = e.fn
+	if e.dedup != nil {
+		e.fn = Idempotent(e.id, e.fn, e.dedup)
+	}
+	if e.txManager != nil {
+		e.fn = transactional(e.txManager, e.fn)
+		e.replayFn = transactional(e.txManager, e.replayFn)
+	}
+	return e
+}
+
+func transactional(manager *TransactionManager, subscriber DomainEventSubscriber) DomainEventSubscriber {
+	return func(ctx context.Context, event DomainEvent) {
+		_ = manager.Transaction(ctx, func(txCtx context.Context) error {
+			subscriber(txCtx, event)
+			return nil
+		})
+	}
+}
+
+// AsyncErrorHandler 处理异步订阅中无法返回给发布方的错误，与具体事件无关的错误 event 为空
+type AsyncErrorHandler func(ctx context.Context, event DomainEvent, err error)
+
+var (
+	asyncErrorHandler     AsyncErrorHandler = logAsyncError
+	asyncErrorHandlerLock sync.RWMutex
+)
+
+// SetAsyncErrorHandler 设置全局的异步错误回调，异步订阅者、Saga、投影、集成事件等没有单独设置回调时都使用它，默认打印日志
+func SetAsyncErrorHandler(fn AsyncErrorHandler) {
+	if fn == nil {
+		return
+	}
+	asyncErrorHandlerLock.Lock()
+	defer asyncErrorHandlerLock.Unlock()
+	asyncErrorHandler = fn
+}
+
+// handleAsyncError 交给 SetAsyncErrorHandler 设置的回调
+func handleAsyncError(ctx context.Context, event DomainEvent, err error) {
+	asyncErrorHandlerLock.RLock()
+	fn := asyncErrorHandler
+	asyncErrorHandlerLock.RUnlock()
+	fn(ctx, event, err)
+}
+
+// logAsyncError 默认的 AsyncErrorHandler，只打印日志
+func logAsyncError(ctx context.Context, event DomainEvent, err error) {
+	if event == nil {
+		log.Printf("async handle failed: %v", err)
+		return
+	}
+	log.Printf("handle %T %s failed: %v", event, event.GetEventId(), err)
 }
 
 func (e *dddEventHandler) Identifier() string {
 	return e.id
 }
 
+func (e *dddEventHandler) Timeout() time.Duration {
+	return e.timeout
+}
+
+func (e *dddEventHandler) Filter(event interface{}) bool {
+	de, ok := event.(DomainEvent)
+	if !ok {
+		return true
+	}
+	return e.accept != nil && !e.accept(de)
+}
+
+// OnEvent 异步订阅者收到的 ctx 已经被 ebus.Detach 包装，只保留 ctx 中的值，
+// 不再是 *TransactionContext，因此不会加入发布方的事务，需要事务时通过 WithTransaction 开启新事务
+// 异步订阅者 panic 或者超时时交给 WithErrorHandler 的回调，不会导致进程退出
 func (e *dddEventHandler) OnEvent(ctx context.Context, event interface{}) {
-	if e.async {
-		// 异步事件去除事务
-		if txCtx, ok := ctx.(*TransactionContext); ok {
-			ctx = txCtx.Ctx()
+	de, ok := event.(DomainEvent)
+	if !ok {
+		return
+	}
+	if !e.async {
+		e.fn(eventHandlingContext(ctx, de), de)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e.onError(ctx, de, fmt.Errorf("subscriber %s panic: %v", e.id, r))
 		}
+	}()
+	e.fn(eventHandlingContext(ctx, de), de)
+	if err := ctx.Err(); err != nil {
+		e.onError(ctx, de, fmt.Errorf("subscriber %s: %w", e.id, err))
 	}
-	e.fn(ctx, event.(DomainEvent))
 }
 
-func RegisterAsyncEventSubscriber(id string, subscriber DomainEventSubscriber) {
-	if err := ebus.RegisterAsync(&dddEventHandler{
-		id:    id,
-		fn:    subscriber,
-		async: true,
-	}, topic); err != nil {
+func RegisterAsyncEventSubscriber(id string, subscriber DomainEventSubscriber, opts ...SubscriberOption) {
+	registerEventHandler(newEventHandler(id, subscriber, true, opts))
+}
+
+func RegisterSyncEventSubscriber(id string, subscriber DomainEventSubscriber, opts ...SubscriberOption) {
+	registerEventHandler(newEventHandler(id, subscriber, false, opts))
+}
+
+// RegisterAsyncEventHandler 异步订阅类型为 T 的领域事件，其他类型的事件不会投递过来
+func RegisterAsyncEventHandler[T DomainEvent](id string, handler func(context.Context, T), opts ...SubscriberOption) {
+	registerEventHandler(newTypedEventHandler(id, handler, true, opts))
+}
+
+// RegisterSyncEventHandler 同步订阅类型为 T 的领域事件，其他类型的事件不会投递过来
+func RegisterSyncEventHandler[T DomainEvent](id string, handler func(context.Context, T), opts ...SubscriberOption) {
+	registerEventHandler(newTypedEventHandler(id, handler, false, opts))
+}
+
+var (
+	eventHandlers     = make(map[string]*dddEventHandler)
+	eventHandlersLock sync.RWMutex
+)
+
+func registerEventHandler(e *dddEventHandler) {
+	var err error
+	if e.async {
+		err = ebus.RegisterAsyncFiltered(e, e.predicate, topic)
+	} else {
+		err = ebus.RegisterFiltered(e, e.predicate, topic)
+	}
+	if err != nil {
 		panic(err)
 	}
+	eventHandlersLock.Lock()
+	defer eventHandlersLock.Unlock()
+	eventHandlers[e.id] = e
+}
+
+func lookupEventHandler(id string) (*dddEventHandler, bool) {
+	eventHandlersLock.RLock()
+	defer eventHandlersLock.RUnlock()
+	e, ok := eventHandlers[id]
+	return e, ok
+}
+
+func newTypedEventHandler[T DomainEvent](id string, handler func(context.Context, T), async bool, opts []SubscriberOption) *dddEventHandler {
+	e := newEventHandler(id, func(ctx context.Context, event DomainEvent) {
+		handler(ctx, event.(T))
+	}, async, opts)
+	e.accept = func(event DomainEvent) bool {
+		_, ok := event.(T)
+		return ok
+	}
+	return e
+}
+
+type DomainEventBatchSubscriber func(context.Context, []DomainEvent)
+
+type dddBatchEventHandler struct {
+	id string
+	fn DomainEventBatchSubscriber
+}
+
+func (e *dddBatchEventHandler) Identifier() string {
+	return e.id
+}
+
+func (e *dddBatchEventHandler) OnEvents(ctx context.Context, events []interface{}) {
+	domainEvents := make([]DomainEvent, 0, len(events))
+	for _, event := range events {
+		if de, ok := event.(DomainEvent); ok {
+			domainEvents = append(domainEvents, de)
+		}
+	}
+	e.fn(ctx, domainEvents)
 }
 
-func RegisterSyncEventSubscriber(id string, subscriber DomainEventSubscriber) {
-	if err := ebus.Register(&dddEventHandler{
-		id:    id,
-		fn:    subscriber,
-		async: false,
-	}, topic); err != nil {
+// RegisterBatchEventSubscriber 批量订阅领域事件，按 policy 聚合后回调，总线关闭时会处理完剩余事件
+func RegisterBatchEventSubscriber(id string, subscriber DomainEventBatchSubscriber, policy ebus.BatchPolicy) {
+	if err := ebus.RegisterBatch(&dddBatchEventHandler{
+		id: id,
+		fn: subscriber,
+	}, policy, topic); err != nil {
 		panic(err)
 	}
 }
@@ -0,0 +1,180 @@
+package ddd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventIdGenerator 生成领域事件 id，生成的 id 应该定长且按时间有序
+type EventIdGenerator interface {
+	NextEventId(ctx context.Context) (string, error)
+}
+
+var (
+	ErrInvalidEventId = errors.New("id generator returned a negative id")
+
+	defaultULIDGenerator                     = NewULIDGenerator()
+	defaultEventIdGenerator EventIdGenerator = defaultULIDGenerator
+	eventIdGeneratorLock    sync.RWMutex
+)
+
+// SetDefaultEventIdGenerator 替换 RaiseEvent 默认使用的事件 id 生成器，默认为 ULID
+func SetDefaultEventIdGenerator(gen EventIdGenerator) {
+	eventIdGeneratorLock.Lock()
+	defer eventIdGeneratorLock.Unlock()
+	defaultEventIdGenerator = gen
+}
+
+func getDefaultEventIdGenerator() EventIdGenerator {
+	eventIdGeneratorLock.RLock()
+	defer eventIdGeneratorLock.RUnlock()
+	return defaultEventIdGenerator
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type ulidGenerator struct {
+	lastMs  uint64
+	entropy [10]byte
+	lock    sync.Mutex
+}
+
+// NewULIDGenerator 生成 26 位的 ULID，同一毫秒内单调递增
+func NewULIDGenerator() EventIdGenerator {
+	return &ulidGenerator{}
+}
+
+func (g *ulidGenerator) NextEventId(ctx context.Context) (string, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ms <= g.lastMs {
+		ms = g.lastMs
+		if !incrementBytes(g.entropy[:]) {
+			// 随机部分溢出，借用下一毫秒
+			ms++
+			if _, err := rand.Read(g.entropy[:]); err != nil {
+				return "", err
+			}
+		}
+	} else if _, err := rand.Read(g.entropy[:]); err != nil {
+		return "", err
+	}
+	g.lastMs = ms
+
+	var raw [16]byte
+	raw[0] = byte(ms >> 40)
+	raw[1] = byte(ms >> 32)
+	raw[2] = byte(ms >> 24)
+	raw[3] = byte(ms >> 16)
+	raw[4] = byte(ms >> 8)
+	raw[5] = byte(ms)
+	copy(raw[6:], g.entropy[:])
+	return encodeCrockford(raw), nil
+}
+
+// encodeCrockford 把 128 位按 5 位一组编码成 26 个字符，首字符只用到高 3 位
+func encodeCrockford(raw [16]byte) string {
+	hi := binary.BigEndian.Uint64(raw[:8])
+	lo := binary.BigEndian.Uint64(raw[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+func incrementBytes(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type uuidV7Generator struct {
+	lastMs uint64
+	seq    uint16
+	lock   sync.Mutex
+}
+
+// NewUUIDv7Generator 生成 36 位的 UUIDv7，rand_a 的 12 位作为同一毫秒内的序号保证有序
+func NewUUIDv7Generator() EventIdGenerator {
+	return &uuidV7Generator{}
+}
+
+func (g *uuidV7Generator) NextEventId(ctx context.Context) (string, error) {
+	var raw [16]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", err
+	}
+
+	g.lock.Lock()
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ms <= g.lastMs {
+		ms = g.lastMs
+		g.seq++
+		if g.seq > 0x0fff {
+			ms++
+			g.seq = 0
+		}
+	} else {
+		g.seq = 0
+	}
+	g.lastMs = ms
+	seq := g.seq
+	g.lock.Unlock()
+
+	raw[0] = byte(ms >> 40)
+	raw[1] = byte(ms >> 32)
+	raw[2] = byte(ms >> 24)
+	raw[3] = byte(ms >> 16)
+	raw[4] = byte(ms >> 8)
+	raw[5] = byte(ms)
+	raw[6] = 0x70 | byte(seq>>8)
+	raw[7] = byte(seq)
+	raw[8] = 0x80 | raw[8]&0x3f
+
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], raw[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], raw[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], raw[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], raw[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], raw[10:])
+	return string(buf), nil
+}
+
+type idGeneratorAdapter struct {
+	idGen IdGenerator
+}
+
+// NewEventIdGenerator 使用 IdGenerator 生成事件 id，补零到 19 位以保证定长有序
+func NewEventIdGenerator(idGen IdGenerator) EventIdGenerator {
+	return &idGeneratorAdapter{idGen: idGen}
+}
+
+func (g *idGeneratorAdapter) NextEventId(ctx context.Context) (string, error) {
+	id, err := g.idGen.Gen(ctx)
+	if err != nil {
+		return "", err
+	}
+	if id < 0 {
+		return "", ErrInvalidEventId
+	}
+	return fmt.Sprintf("%019d", id), nil
+}
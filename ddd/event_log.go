@@ -0,0 +1,242 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StoredEvent 事件日志中的一条事件，Position 在日志内单调递增
+// 位置在事务提交后才分配，读到某个位置之后，不会再出现比它小的位置
+type StoredEvent struct {
+	Position int64
+	Event    DomainEvent
+}
+
+// EventLog 按顺序持久化领域事件，供投影、重放等场景读取
+type EventLog interface {
+	Append(ctx context.Context, events ...DomainEvent) error
+	// Read 读取 Position 大于 afterPosition 的事件，最多 limit 条
+	Read(ctx context.Context, afterPosition int64, limit int) ([]*StoredEvent, error)
+	// Query 按条件查询事件，结果按 Position 升序排列
+	Query(ctx context.Context, query EventQuery) ([]*StoredEvent, error)
+}
+
+// EventQuery 事件查询条件，零值的条件不生效
+type EventQuery struct {
+	AfterPosition int64
+	// From、To 按事件发生时间过滤，左闭右开
+	From          time.Time
+	To            time.Time
+	AggregateId   int64
+	AggregateType string
+	EventTypes    []string
+	Limit         int
+}
+
+// EventSequencer 事件写入时还没有位置，由 Sequence 在事务提交后按顺序分配
+// 写入时就分配的话，后分配位置的事务先提交，读者越过前面还没提交的位置后再也读不到它
+type EventSequencer interface {
+	Sequence(ctx context.Context) error
+}
+
+// sequenceEventLog 读取事件日志前先为已经提交的事件分配位置
+func sequenceEventLog(ctx context.Context, log EventLog) error {
+	if sequencer, ok := log.(EventSequencer); ok {
+		return sequencer.Sequence(ctx)
+	}
+	return nil
+}
+
+type EventLogRecord struct {
+	Id int64 `gorm:"primaryKey;autoIncrement"`
+	// Position 由 Sequence 分配，分配前为空，读取时不可见
+	Position      *int64 `gorm:"uniqueIndex"`
+	EventId       string `gorm:"size:64;uniqueIndex"`
+	EventType     string `gorm:"size:128;index"`
+	SchemaVersion int
+	AggregateId   int64  `gorm:"index"`
+	AggregateType string `gorm:"size:128"`
+	OccurredOn    int64  `gorm:"index"`
+	ContentType   string `gorm:"size:64"`
+	Metadata      []byte
+	Payload       []byte
+	CreateTime    time.Time `gorm:"autoCreateTime"`
+}
+
+func (EventLogRecord) TableName() string {
+	return "ddd_event_log"
+}
+
+const eventLogSequenceName = "ddd_event_log"
+
+// EventLogSequence 记录已经分配的最大位置，分配时锁住这条记录保证同一时刻只有一个进程在分配
+type EventLogSequence struct {
+	Name     string `gorm:"primaryKey;size:64"`
+	Position int64
+}
+
+func (EventLogSequence) TableName() string {
+	return "ddd_event_log_sequence"
+}
+
+const defaultSequenceBatchSize = 500
+
+type GormEventLog struct {
+	factory    DBFactory
+	serializer *EventSerializer
+}
+
+func NewGormEventLog(factory DBFactory, serializer *EventSerializer) *GormEventLog {
+	if serializer == nil {
+		serializer = NewEventSerializer(nil, nil)
+	}
+	return &GormEventLog{
+		factory:    factory,
+		serializer: serializer,
+	}
+}
+
+func (l *GormEventLog) Append(ctx context.Context, events ...DomainEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	records := make([]*EventLogRecord, 0, len(events))
+	for _, event := range events {
+		record, err := l.toRecord(event)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	db, err := lookupWriteDB(ctx, l.factory)
+	if err != nil {
+		return err
+	}
+	// 事件 id 已经存在说明重复投递，忽略即可
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&records).Error
+}
+
+// Sequence 按写入顺序为已经提交、还没有位置的事件分配位置，在独立的事务中执行
+func (l *GormEventLog) Sequence(ctx context.Context) error {
+	db, err := l.factory.LookupWriteDB(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		seq := &EventLogSequence{Name: eventLogSequenceName}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(seq).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(seq, "name = ?", seq.Name).Error; err != nil {
+			return err
+		}
+		start := seq.Position
+		for {
+			var ids []int64
+			err := tx.Model(&EventLogRecord{}).Where("position IS NULL").
+				Order("id").Limit(defaultSequenceBatchSize).Pluck("id", &ids).Error
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				seq.Position++
+				if err := tx.Model(&EventLogRecord{}).Where("id = ?", id).Update("position", seq.Position).Error; err != nil {
+					return err
+				}
+			}
+			if len(ids) < defaultSequenceBatchSize {
+				break
+			}
+		}
+		if seq.Position == start {
+			return nil
+		}
+		return tx.Model(seq).Update("position", seq.Position).Error
+	})
+}
+
+func (l *GormEventLog) Read(ctx context.Context, afterPosition int64, limit int) ([]*StoredEvent, error) {
+	return l.Query(ctx, EventQuery{AfterPosition: afterPosition, Limit: limit})
+}
+
+func (l *GormEventLog) Query(ctx context.Context, query EventQuery) ([]*StoredEvent, error) {
+	db, err := lookupDB(ctx, l.factory)
+	if err != nil {
+		return nil, err
+	}
+	db = db.Where("position > ?", query.AfterPosition)
+	if !query.From.IsZero() {
+		db = db.Where("occurred_on >= ?", query.From.Unix())
+	}
+	if !query.To.IsZero() {
+		db = db.Where("occurred_on < ?", query.To.Unix())
+	}
+	if query.AggregateId > 0 {
+		db = db.Where("aggregate_id = ?", query.AggregateId)
+	}
+	if query.AggregateType != "" {
+		db = db.Where("aggregate_type = ?", query.AggregateType)
+	}
+	if len(query.EventTypes) > 0 {
+		db = db.Where("event_type IN ?", query.EventTypes)
+	}
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+	var records []*EventLogRecord
+	if err = db.Order("position").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return l.toStoredEvents(records)
+}
+
+func (l *GormEventLog) toRecord(event DomainEvent) (*EventLogRecord, error) {
+	serialized, err := l.serializer.Serialize(event)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := json.Marshal(serialized.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLogRecord{
+		EventId:       serialized.EventId,
+		EventType:     serialized.EventType,
+		SchemaVersion: serialized.SchemaVersion,
+		AggregateId:   serialized.Metadata.AggregateId,
+		AggregateType: serialized.Metadata.AggregateType,
+		OccurredOn:    serialized.OccurredOn,
+		ContentType:   serialized.ContentType,
+		Metadata:      metadata,
+		Payload:       serialized.Payload,
+	}, nil
+}
+
+func (l *GormEventLog) toStoredEvents(records []*EventLogRecord) ([]*StoredEvent, error) {
+	rlt := make([]*StoredEvent, 0, len(records))
+	for _, record := range records {
+		serialized := &SerializedEvent{
+			EventId:       record.EventId,
+			EventType:     record.EventType,
+			SchemaVersion: record.SchemaVersion,
+			OccurredOn:    record.OccurredOn,
+			ContentType:   record.ContentType,
+			Payload:       record.Payload,
+		}
+		if len(record.Metadata) > 0 {
+			if err := json.Unmarshal(record.Metadata, &serialized.Metadata); err != nil {
+				return nil, err
+			}
+		}
+		event, err := l.serializer.Deserialize(serialized)
+		if err != nil {
+			return nil, err
+		}
+		rlt = append(rlt, &StoredEvent{Position: *record.Position, Event: event})
+	}
+	return rlt, nil
+}
@@ -0,0 +1,134 @@
+package ddd
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+var ErrIdempotencyRequiresTransaction = errors.New("idempotency store requires a transaction")
+
+// IdempotencyStore 记录每个订阅者已经处理过的事件 id
+type IdempotencyStore interface {
+	// Claim 标记订阅者开始处理该事件，已经处理过时返回 false
+	Claim(ctx context.Context, subscriberId, eventId string) (bool, error)
+	// Release 处理失败时撤销标记，允许事件重新投递
+	Release(ctx context.Context, subscriberId, eventId string) error
+}
+
+// Idempotent 包装订阅者，重复投递的事件直接跳过
+// 存储异常时按未处理对待，保证事件至少被处理一次
+func Idempotent(subscriberId string, subscriber DomainEventSubscriber, store IdempotencyStore) DomainEventSubscriber {
+	return func(ctx context.Context, event DomainEvent) {
+		eventId := event.GetEventId()
+		if eventId == "" {
+			subscriber(ctx, event)
+			return
+		}
+		claimed, err := store.Claim(ctx, subscriberId, eventId)
+		if err == nil && !claimed {
+			return
+		}
+		handled := false
+		defer func() {
+			if !handled && err == nil {
+				_ = store.Release(ctx, subscriberId, eventId)
+			}
+		}()
+		subscriber(ctx, event)
+		handled = true
+	}
+}
+
+type lruIdempotencyStore struct {
+	capacity int
+	items    *list.List
+	index    map[string]*list.Element
+	lock     sync.Mutex
+}
+
+// NewLRUIdempotencyStore 内存中保存最近处理过的 capacity 个事件，只能在单进程内去重
+func NewLRUIdempotencyStore(capacity int) IdempotencyStore {
+	return &lruIdempotencyStore{
+		capacity: capacity,
+		items:    list.New(),
+		index:    make(map[string]*list.Element),
+	}
+}
+
+func (s *lruIdempotencyStore) Claim(ctx context.Context, subscriberId, eventId string) (bool, error) {
+	key := subscriberId + "\x00" + eventId
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ele, ok := s.index[key]; ok {
+		s.items.MoveToFront(ele)
+		return false, nil
+	}
+	s.index[key] = s.items.PushFront(key)
+	for s.capacity > 0 && s.items.Len() > s.capacity {
+		oldest := s.items.Back()
+		s.items.Remove(oldest)
+		delete(s.index, oldest.Value.(string))
+	}
+	return true, nil
+}
+
+func (s *lruIdempotencyStore) Release(ctx context.Context, subscriberId, eventId string) error {
+	key := subscriberId + "\x00" + eventId
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ele, ok := s.index[key]; ok {
+		s.items.Remove(ele)
+		delete(s.index, key)
+	}
+	return nil
+}
+
+type ProcessedEvent struct {
+	SubscriberId string    `gorm:"primaryKey;size:128"`
+	EventId      string    `gorm:"primaryKey;size:64"`
+	CreateTime   time.Time `gorm:"autoCreateTime"`
+}
+
+func (ProcessedEvent) TableName() string {
+	return "ddd_processed_event"
+}
+
+type GormIdempotencyStore struct {
+	factory DBFactory
+}
+
+// NewGormIdempotencyStore 标记与订阅者的写操作在同一个事务中提交或回滚，订阅者需要配合 WithTransaction 使用
+func NewGormIdempotencyStore(factory DBFactory) *GormIdempotencyStore {
+	return &GormIdempotencyStore{factory: factory}
+}
+
+// Claim 必须在事务中调用，否则标记先于处理提交，进程在处理中途退出时事件会被当作已处理，变成至多一次
+func (s *GormIdempotencyStore) Claim(ctx context.Context, subscriberId, eventId string) (bool, error) {
+	txCtx, ok := ctx.(*TransactionContext)
+	if !ok || !txCtx.InTransaction() {
+		return false, ErrIdempotencyRequiresTransaction
+	}
+	rlt := txCtx.TxDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&ProcessedEvent{
+		SubscriberId: subscriberId,
+		EventId:      eventId,
+	})
+	if rlt.Error != nil {
+		return false, rlt.Error
+	}
+	return rlt.RowsAffected > 0, nil
+}
+
+func (s *GormIdempotencyStore) Release(ctx context.Context, subscriberId, eventId string) error {
+	db, err := lookupWriteDB(ctx, s.factory)
+	if err != nil {
+		return err
+	}
+	return db.Where("subscriber_id = ? AND event_id = ?", subscriberId, eventId).Delete(&ProcessedEvent{}).Error
+}
@@ -0,0 +1,191 @@
+package ddd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InboxStatus string
+
+const (
+	InboxPending   InboxStatus = "PENDING"
+	InboxProcessed InboxStatus = "PROCESSED"
+	InboxFailed    InboxStatus = "FAILED"
+)
+
+const defaultInboxMaxAttempts = 5
+
+// InboxMessage 收件箱中的一条外部集成事件，MessageId 由发送方保证唯一
+type InboxMessage struct {
+	Id            int64       `gorm:"primaryKey;autoIncrement"`
+	MessageId     string      `gorm:"size:128;uniqueIndex"`
+	Source        string      `gorm:"size:128"`
+	EventType     string      `gorm:"size:128"`
+	SchemaVersion int         `gorm:"not null"`
+	ContentType   string      `gorm:"size:64"`
+	Payload       []byte      `gorm:"not null"`
+	Status        InboxStatus `gorm:"size:32;index"`
+	Attempts      int         `gorm:"not null"`
+	Error         string      `gorm:"type:text"`
+	ProcessTime   *time.Time  `gorm:"index"`
+	CreateTime    time.Time   `gorm:"autoCreateTime"`
+	UpdateTime    time.Time   `gorm:"autoUpdateTime"`
+}
+
+func (InboxMessage) TableName() string {
+	return "ddd_inbox"
+}
+
+// Inbox 收件箱：收到消息时先落库，再由 ProcessPending 按消息 id 去重后交给领域事件订阅者
+type Inbox struct {
+	factory     DBFactory
+	txManager   *TransactionManager
+	serializer  *EventSerializer
+	publisher   DomainEventPublisher
+	maxAttempts int
+}
+
+func NewInbox(factory DBFactory, txManager *TransactionManager, serializer *EventSerializer, publisher DomainEventPublisher) *Inbox {
+	if serializer == nil {
+		serializer = NewEventSerializer(nil, nil)
+	}
+	return &Inbox{
+		factory:     factory,
+		txManager:   txManager,
+		serializer:  serializer,
+		publisher:   publisher,
+		maxAttempts: defaultInboxMaxAttempts,
+	}
+}
+
+// SetMaxAttempts 处理失败超过 maxAttempts 次后标记为 FAILED，不再重试
+func (i *Inbox) SetMaxAttempts(maxAttempts int) {
+	if maxAttempts > 0 {
+		i.maxAttempts = maxAttempts
+	}
+}
+
+// Receive 写入收件箱，ctx 在事务中时与调用方一起提交；messageId 已经存在时返回 false
+func (i *Inbox) Receive(ctx context.Context, messageId, source string, event *SerializedEvent) (bool, error) {
+	db, err := lookupWriteDB(ctx, i.factory)
+	if err != nil {
+		return false, err
+	}
+	rlt := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&InboxMessage{
+		MessageId:     messageId,
+		Source:        source,
+		EventType:     event.EventType,
+		SchemaVersion: event.SchemaVersion,
+		ContentType:   event.ContentType,
+		Payload:       event.Payload,
+		Status:        InboxPending,
+	})
+	if rlt.Error != nil {
+		return false, rlt.Error
+	}
+	return rlt.RowsAffected > 0, nil
+}
+
+// ProcessPending 处理最多 limit 条待处理消息，每条消息一个事务，同步订阅者与状态更新一起提交
+// 返回成功处理的条数
+func (i *Inbox) ProcessPending(ctx context.Context, limit int) (int, error) {
+	db, err := i.factory.LookupWriteDB(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	err = db.Model(&InboxMessage{}).Where("status = ?", InboxPending).
+		Order("id").Limit(limit).Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	processed := 0
+	for _, id := range ids {
+		err = i.txManager.Transaction(ctx, func(txCtx context.Context) error {
+			return i.process(txCtx, id)
+		})
+		if err == nil {
+			processed++
+			continue
+		}
+		if err = i.markAttemptFailed(ctx, id, err); err != nil {
+			return processed, err
+		}
+	}
+	return processed, nil
+}
+
+// process 同步订阅者 panic 时转换成错误返回，事务正常回滚后由调用方记录失败次数
+func (i *Inbox) process(ctx context.Context, id int64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("process inbox message %d panic: %v", id, r)
+		}
+	}()
+	db, err := lookupWriteDB(ctx, i.factory)
+	if err != nil {
+		return err
+	}
+	var messages []*InboxMessage
+	err = db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND status = ?", id, InboxPending).Limit(1).Find(&messages).Error
+	if err != nil || len(messages) == 0 {
+		// 已经被其他实例处理
+		return err
+	}
+	message := messages[0]
+	event, err := i.serializer.Deserialize(&SerializedEvent{
+		EventType:     message.EventType,
+		SchemaVersion: message.SchemaVersion,
+		ContentType:   message.ContentType,
+		Payload:       message.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	if err = i.publisher.Publish(ctx, event); err != nil {
+		return err
+	}
+	now := time.Now()
+	return db.Model(message).Updates(map[string]interface{}{
+		"status":       InboxProcessed,
+		"process_time": &now,
+		"attempts":     gorm.Expr("attempts + 1"),
+	}).Error
+}
+
+func (i *Inbox) markAttemptFailed(ctx context.Context, id int64, cause error) error {
+	db, err := i.factory.LookupWriteDB(ctx)
+	if err != nil {
+		return err
+	}
+	var messages []*InboxMessage
+	if err = db.Where("id = ? AND status = ?", id, InboxPending).Limit(1).Find(&messages).Error; err != nil || len(messages) == 0 {
+		return err
+	}
+	message := messages[0]
+	status := InboxPending
+	if message.Attempts+1 >= i.maxAttempts {
+		status = InboxFailed
+	}
+	return db.Model(message).Where("status = ?", InboxPending).Updates(map[string]interface{}{
+		"attempts": message.Attempts + 1,
+		"error":    fmt.Sprintf("%v", cause),
+		"status":   status,
+	}).Error
+}
+
+// Cleanup 删除处理完成超过 retention 的消息，返回删除的条数
+// 删除后同一个 messageId 再次到达会被当作新消息，retention 需要大于发送方的最大重试窗口
+func (i *Inbox) Cleanup(ctx context.Context, retention time.Duration) (int64, error) {
+	db, err := i.factory.LookupWriteDB(ctx)
+	if err != nil {
+		return 0, err
+	}
+	rlt := db.Where("status = ? AND process_time < ?", InboxProcessed, time.Now().Add(-retention)).Delete(&InboxMessage{})
+	return rlt.RowsAffected, rlt.Error
+}
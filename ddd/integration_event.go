@@ -0,0 +1,165 @@
+package ddd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/zhenyu888/ddd-core/ebus"
+)
+
+// IntegrationEvent 对其他限界上下文公开的集成事件，Payload 是对外约定的结构，与内部领域事件解耦
+type IntegrationEvent struct {
+	EventId       string      `json:"eventId"`
+	EventType     string      `json:"eventType"`
+	Source        string      `json:"source"`
+	OccurredOn    int64       `json:"occurredOn"`
+	CorrelationId string      `json:"correlationId,omitempty"`
+	Payload       interface{} `json:"payload"`
+}
+
+type IntegrationEventPublisher interface {
+	Publish(context.Context, *IntegrationEvent) error
+}
+
+var (
+	IntegrationEventPublisherName = "ddd:core:IntegrationEventPublisher"
+	integrationTopic              = "ddd:integration_event_topic"
+)
+
+// NewIntegrationEventPublisher 集成事件发布在独立的 topic 上，领域事件订阅者不会收到
+func NewIntegrationEventPublisher() IntegrationEventPublisher {
+	rlt := LoadOrStoreComponent(&ebusIntegrationPublisher{}, func() interface{} {
+		return &ebusIntegrationPublisher{}
+	})
+	return rlt.(IntegrationEventPublisher)
+}
+
+type ebusIntegrationPublisher struct{}
+
+func (p *ebusIntegrationPublisher) Name() string {
+	return IntegrationEventPublisherName
+}
+
+func (p *ebusIntegrationPublisher) Publish(ctx context.Context, event *IntegrationEvent) error {
+	err := ebus.Post(ctx, integrationTopic, event)
+	if err == ebus.ErrTopicNotFound {
+		// 没有任何订阅者时直接丢弃
+		return nil
+	}
+	return err
+}
+
+type IntegrationEventSubscriber func(context.Context, *IntegrationEvent)
+
+type integrationEventHandler struct {
+	id string
+	fn IntegrationEventSubscriber
+}
+
+func (h *integrationEventHandler) Identifier() string {
+	return h.id
+}
+
+func (h *integrationEventHandler) OnEvent(ctx context.Context, event interface{}) {
+	if ie, ok := event.(*IntegrationEvent); ok {
+		h.fn(ctx, ie)
+	}
+}
+
+// RegisterIntegrationEventSubscriber 异步订阅集成事件，一般用来转发到消息队列，id 重复时返回错误
+func RegisterIntegrationEventSubscriber(id string, subscriber IntegrationEventSubscriber) error {
+	return ebus.RegisterAsync(&integrationEventHandler{id: id, fn: subscriber}, integrationTopic)
+}
+
+type integrationMapping struct {
+	eventType string
+	mapFn     func(ctx context.Context, event DomainEvent) (interface{}, error)
+}
+
+// IntegrationEventMapper 把选定的领域事件翻译成集成事件，事务提交后再发布
+type IntegrationEventMapper struct {
+	source    string
+	publisher IntegrationEventPublisher
+	mappings  map[reflect.Type]*integrationMapping
+	onError   AsyncErrorHandler
+}
+
+// NewIntegrationEventMapper source 标识当前限界上下文，publisher 为空时使用默认发布者
+func NewIntegrationEventMapper(source string, publisher IntegrationEventPublisher) *IntegrationEventMapper {
+	if publisher == nil {
+		publisher = NewIntegrationEventPublisher()
+	}
+	return &IntegrationEventMapper{
+		source:    source,
+		publisher: publisher,
+		mappings:  make(map[reflect.Type]*integrationMapping),
+		onError:   handleAsyncError,
+	}
+}
+
+// SetErrorHandler Listen 中翻译或者发布集成事件失败时回调，默认使用 SetAsyncErrorHandler 设置的回调
+func (m *IntegrationEventMapper) SetErrorHandler(fn AsyncErrorHandler) {
+	if fn != nil {
+		m.onError = fn
+	}
+}
+
+// MapIntegrationEvent 把类型为 T 的领域事件翻译成 eventType 类型的集成事件，fn 返回 nil 时不发布
+func MapIntegrationEvent[T DomainEvent](m *IntegrationEventMapper, eventType string, fn func(ctx context.Context, event T) (interface{}, error)) *IntegrationEventMapper {
+	m.mappings[reflect.TypeOf((*T)(nil)).Elem()] = &integrationMapping{
+		eventType: eventType,
+		mapFn: func(ctx context.Context, event DomainEvent) (interface{}, error) {
+			return fn(ctx, event.(T))
+		},
+	}
+	return m
+}
+
+// Map 把领域事件翻译成集成事件，没有对应映射时返回 nil
+func (m *IntegrationEventMapper) Map(ctx context.Context, event DomainEvent) (*IntegrationEvent, error) {
+	mapping, ok := m.mappings[reflect.TypeOf(event)]
+	if !ok {
+		return nil, nil
+	}
+	payload, err := mapping.mapFn(ctx, event)
+	if err != nil || payload == nil {
+		return nil, err
+	}
+	rlt := &IntegrationEvent{
+		EventId:    event.GetEventId(),
+		EventType:  mapping.eventType,
+		Source:     m.source,
+		OccurredOn: event.GetOccurredOn(),
+		Payload:    payload,
+	}
+	if holder, ok := event.(DomainEventMetadata); ok {
+		rlt.CorrelationId = holder.GetMetadata().CorrelationId
+	}
+	return rlt, nil
+}
+
+// Listen 同步订阅领域事件，在事务中时等到提交成功后才发布集成事件
+// 翻译和发布的错误交给 SetErrorHandler 的回调，不影响领域事件的发布方
+func (m *IntegrationEventMapper) Listen(id string) {
+	RegisterSyncEventSubscriber(id, func(ctx context.Context, event DomainEvent) {
+		ie, err := m.Map(ctx, event)
+		if err != nil {
+			m.onError(ctx, event, fmt.Errorf("map integration event: %w", err))
+			return
+		}
+		if ie == nil {
+			return
+		}
+		publish := func(ctx context.Context) {
+			if err := m.publisher.Publish(ctx, ie); err != nil {
+				m.onError(ctx, event, fmt.Errorf("publish integration event %s: %w", ie.EventType, err))
+			}
+		}
+		if txCtx, ok := ctx.(*TransactionContext); ok {
+			txCtx.AfterCommit(publish)
+		} else {
+			publish(ctx)
+		}
+	})
+}
@@ -0,0 +1,199 @@
+package ddd
+
+import (
+	"context"
+
+	"github.com/zhenyu888/ddd-core/funcs"
+)
+
+// EventMetadata 领域事件的元数据，用来定位产生事件的聚合以及关联请求链路
+type EventMetadata struct {
+	AggregateId      int64  `json:"aggregateId,omitempty"`
+	AggregateType    string `json:"aggregateType,omitempty"`
+	AggregateVersion int64  `json:"aggregateVersion,omitempty"`
+	// CorrelationId 同一条业务链路上的事件共享同一个 CorrelationId
+	CorrelationId string `json:"correlationId,omitempty"`
+	// CausationId 直接导致该事件产生的事件 id
+	CausationId   string `json:"causationId,omitempty"`
+	Actor         string `json:"actor,omitempty"`
+	SchemaVersion int    `json:"schemaVersion,omitempty"`
+}
+
+// DomainEventMetadata 需要携带元数据的领域事件实现该接口，一般直接嵌入 BaseDomainEvent
+type DomainEventMetadata interface {
+	GetMetadata() EventMetadata
+	SetMetadata(EventMetadata)
+}
+
+// BaseDomainEvent 提供事件 id、发生时间和元数据的默认实现，领域事件嵌入后只需要实现 String
+type BaseDomainEvent struct {
+	EventId    string        `json:"eventId"`
+	OccurredOn int64         `json:"occurredOn"`
+	Metadata   EventMetadata `json:"metadata"`
+}
+
+func (e *BaseDomainEvent) GetEventId() string {
+	return e.EventId
+}
+
+func (e *BaseDomainEvent) GetOccurredOn() int64 {
+	return e.OccurredOn
+}
+
+func (e *BaseDomainEvent) SetEventId(id string) {
+	e.EventId = id
+}
+
+func (e *BaseDomainEvent) SetOccurredOn(occurredOn int64) {
+	e.OccurredOn = occurredOn
+}
+
+func (e *BaseDomainEvent) GetMetadata() EventMetadata {
+	return e.Metadata
+}
+
+func (e *BaseDomainEvent) SetMetadata(metadata EventMetadata) {
+	e.Metadata = metadata
+}
+
+// VersionedAggregate 带版本号（比如乐观锁版本）的聚合
+// AroundSave 在调用 doSave 之前读取 AggregateVersion 填入事件，事件中已经设置的版本不覆盖：
+// 版本在 doSave 中递增时（比如 gorm 的乐观锁插件）记录的是这次保存之前的版本，在领域方法中递增时是递增后的版本
+type VersionedAggregate interface {
+	AggregateVersion() int64
+}
+
+// AggregateTyper 自定义聚合类型名，未实现时使用结构体名
+type AggregateTyper interface {
+	AggregateType() string
+}
+
+// EventSchemaVersioner 领域事件结构的版本号，未实现时为 1
+type EventSchemaVersioner interface {
+	SchemaVersion() int
+}
+
+func AggregateTypeName(agg Aggregate) string {
+	if typer, ok := agg.(AggregateTyper); ok {
+		return typer.AggregateType()
+	}
+	return funcs.ReflectValueName(agg)
+}
+
+func EventSchemaVersion(event DomainEvent) int {
+	if versioner, ok := event.(EventSchemaVersioner); ok {
+		return versioner.SchemaVersion()
+	}
+	return 1
+}
+
+type metadataCtxKey int
+
+const (
+	correlationIdKey metadataCtxKey = iota
+	causationIdKey
+	actorKey
+)
+
+func WithCorrelationId(ctx context.Context, correlationId string) context.Context {
+	return contextWithValue(ctx, correlationIdKey, correlationId)
+}
+
+func CorrelationIdFromContext(ctx context.Context) string {
+	rlt, _ := ctx.Value(correlationIdKey).(string)
+	return rlt
+}
+
+func WithCausationId(ctx context.Context, causationId string) context.Context {
+	return contextWithValue(ctx, causationIdKey, causationId)
+}
+
+func CausationIdFromContext(ctx context.Context) string {
+	rlt, _ := ctx.Value(causationIdKey).(string)
+	return rlt
+}
+
+// WithActor 记录当前操作人，写入领域事件元数据
+func WithActor(ctx context.Context, actor string) context.Context {
+	return contextWithValue(ctx, actorKey, actor)
+}
+
+func ActorFromContext(ctx context.Context) string {
+	rlt, _ := ctx.Value(actorKey).(string)
+	return rlt
+}
+
+// contextWithValue 与 context.WithValue 相同，但会保留 TransactionContext，避免丢失事务
+func contextWithValue(ctx context.Context, key, value interface{}) context.Context {
+	if txCtx, ok := ctx.(*TransactionContext); ok {
+		return &TransactionContext{
+			ctx:    context.WithValue(txCtx.ctx, key, value),
+			tx:     txCtx.tx,
+			parent: txCtx.parent,
+			hooks:  txCtx.hooks,
+		}
+	}
+	return context.WithValue(ctx, key, value)
+}
+
+// fillAggregateMetadata 用聚合的信息补全事件元数据，已经设置过的字段不覆盖
+func fillAggregateMetadata(event DomainEvent, agg Aggregate) {
+	holder, ok := event.(DomainEventMetadata)
+	if !ok {
+		return
+	}
+	metadata := holder.GetMetadata()
+	if metadata.SchemaVersion <= 0 {
+		metadata.SchemaVersion = EventSchemaVersion(event)
+	}
+	if agg != nil {
+		if metadata.AggregateId <= 0 {
+			metadata.AggregateId = agg.AggregateId()
+		}
+		if metadata.AggregateType == "" {
+			metadata.AggregateType = AggregateTypeName(agg)
+		}
+		if versioned, ok := agg.(VersionedAggregate); ok && metadata.AggregateVersion <= 0 {
+			metadata.AggregateVersion = versioned.AggregateVersion()
+		}
+	}
+	holder.SetMetadata(metadata)
+}
+
+// fillContextMetadata 用请求上下文补全事件元数据，已经设置过的字段不覆盖
+func fillContextMetadata(ctx context.Context, event DomainEvent) {
+	holder, ok := event.(DomainEventMetadata)
+	if !ok {
+		return
+	}
+	metadata := holder.GetMetadata()
+	if metadata.CorrelationId == "" {
+		metadata.CorrelationId = CorrelationIdFromContext(ctx)
+	}
+	if metadata.CorrelationId == "" {
+		// 链路上的第一个事件，以自身 id 作为链路标识
+		metadata.CorrelationId = event.GetEventId()
+	}
+	if metadata.CausationId == "" {
+		metadata.CausationId = CausationIdFromContext(ctx)
+	}
+	if metadata.Actor == "" {
+		metadata.Actor = ActorFromContext(ctx)
+	}
+	holder.SetMetadata(metadata)
+}
+
+// eventHandlingContext 处理事件时把当前事件记录为后续事件的起因，并沿用事件的链路标识
+func eventHandlingContext(ctx context.Context, event DomainEvent) context.Context {
+	ctx = WithCausationId(ctx, event.GetEventId())
+	if holder, ok := event.(DomainEventMetadata); ok {
+		metadata := holder.GetMetadata()
+		if metadata.CorrelationId != "" {
+			ctx = WithCorrelationId(ctx, metadata.CorrelationId)
+		}
+		if metadata.Actor != "" && ActorFromContext(ctx) == "" {
+			ctx = WithActor(ctx, metadata.Actor)
+		}
+	}
+	return ctx
+}
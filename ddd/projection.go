@@ -0,0 +1,325 @@
+package ddd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrProjectionNotFound          = errors.New("projection not found")
+	ErrProjectionAlreadyRegistered = errors.New("projection already registered")
+)
+
+type ProjectionHandler func(ctx context.Context, event DomainEvent) error
+
+// Projection 读模型投影，按事件类型注册处理函数，未注册的事件类型直接跳过
+type Projection struct {
+	name     string
+	handlers map[reflect.Type]ProjectionHandler
+	reset    func(ctx context.Context) error
+}
+
+func NewProjection(name string) *Projection {
+	return &Projection{
+		name:     name,
+		handlers: make(map[reflect.Type]ProjectionHandler),
+	}
+}
+
+func (p *Projection) Name() string {
+	return p.name
+}
+
+// OnReset 重建投影前清空读模型
+func (p *Projection) OnReset(fn func(ctx context.Context) error) *Projection {
+	p.reset = fn
+	return p
+}
+
+func (p *Projection) handle(ctx context.Context, event DomainEvent) error {
+	if handler, ok := p.handlers[reflect.TypeOf(event)]; ok {
+		return handler(ctx, event)
+	}
+	return nil
+}
+
+// On 为投影注册类型为 T 的事件处理函数，T 必须是具体的事件类型
+func On[T DomainEvent](p *Projection, handler func(ctx context.Context, event T) error) *Projection {
+	p.handlers[reflect.TypeOf((*T)(nil)).Elem()] = func(ctx context.Context, event DomainEvent) error {
+		return handler(ctx, event.(T))
+	}
+	return p
+}
+
+// CheckpointStore 记录每个投影最后处理到的事件位置
+type CheckpointStore interface {
+	Load(ctx context.Context, name string) (int64, error)
+	Save(ctx context.Context, name string, position int64) error
+}
+
+type memoryCheckpointStore struct {
+	positions map[string]int64
+	lock      sync.RWMutex
+}
+
+func NewMemoryCheckpointStore() CheckpointStore {
+	return &memoryCheckpointStore{positions: make(map[string]int64)}
+}
+
+func (s *memoryCheckpointStore) Load(ctx context.Context, name string) (int64, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.positions[name], nil
+}
+
+func (s *memoryCheckpointStore) Save(ctx context.Context, name string, position int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.positions[name] = position
+	return nil
+}
+
+type ProjectionCheckpoint struct {
+	Name       string    `gorm:"primaryKey;size:128"`
+	Position   int64     `gorm:"not null"`
+	UpdateTime time.Time `gorm:"autoUpdateTime"`
+}
+
+func (ProjectionCheckpoint) TableName() string {
+	return "ddd_projection_checkpoint"
+}
+
+type GormCheckpointStore struct {
+	factory DBFactory
+}
+
+// NewGormCheckpointStore 检查点与读模型在同一个库时，可以和读模型的更新放在同一个事务中
+func NewGormCheckpointStore(factory DBFactory) *GormCheckpointStore {
+	return &GormCheckpointStore{factory: factory}
+}
+
+func (s *GormCheckpointStore) Load(ctx context.Context, name string) (int64, error) {
+	db, err := lookupWriteDB(ctx, s.factory)
+	if err != nil {
+		return 0, err
+	}
+	var checkpoints []*ProjectionCheckpoint
+	if err = db.Where("name = ?", name).Limit(1).Find(&checkpoints).Error; err != nil {
+		return 0, err
+	}
+	if len(checkpoints) == 0 {
+		return 0, nil
+	}
+	return checkpoints[0].Position, nil
+}
+
+func (s *GormCheckpointStore) Save(ctx context.Context, name string, position int64) error {
+	db, err := lookupWriteDB(ctx, s.factory)
+	if err != nil {
+		return err
+	}
+	checkpoint := &ProjectionCheckpoint{Name: name, Position: position}
+	return db.Clauses(clause.OnConflict{UpdateAll: true}).Create(checkpoint).Error
+}
+
+const defaultProjectionBatchSize = 100
+
+// ProjectionManager 从事件日志中按检查点增量驱动投影
+type ProjectionManager struct {
+	log         EventLog
+	store       CheckpointStore
+	txManager   *TransactionManager
+	batchSize   int
+	onError     AsyncErrorHandler
+	projections map[string]*Projection
+	locks       map[string]*sync.Mutex
+	lock        sync.RWMutex
+	trigger     chan struct{}
+	listenOnce  sync.Once
+}
+
+// NewProjectionManager txManager 不为空时，每一批事件的处理和检查点的保存在同一个事务中
+func NewProjectionManager(log EventLog, store CheckpointStore, txManager *TransactionManager) *ProjectionManager {
+	return &ProjectionManager{
+		log:         log,
+		store:       store,
+		txManager:   txManager,
+		batchSize:   defaultProjectionBatchSize,
+		onError:     handleAsyncError,
+		projections: make(map[string]*Projection),
+		locks:       make(map[string]*sync.Mutex),
+		trigger:     make(chan struct{}, 1),
+	}
+}
+
+func (m *ProjectionManager) SetBatchSize(batchSize int) {
+	if batchSize > 0 {
+		m.batchSize = batchSize
+	}
+}
+
+// SetErrorHandler Listen、Run 触发的追赶失败时回调，默认使用 SetAsyncErrorHandler 设置的回调，回调中的 event 为空
+func (m *ProjectionManager) SetErrorHandler(fn AsyncErrorHandler) {
+	if fn != nil {
+		m.onError = fn
+	}
+}
+
+func (m *ProjectionManager) Register(p *Projection) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.projections[p.name]; ok {
+		return fmt.Errorf("%w: %s", ErrProjectionAlreadyRegistered, p.name)
+	}
+	m.projections[p.name] = p
+	m.locks[p.name] = &sync.Mutex{}
+	return nil
+}
+
+func (m *ProjectionManager) lookup(name string) (*Projection, *sync.Mutex, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	p, ok := m.projections[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrProjectionNotFound, name)
+	}
+	return p, m.locks[name], nil
+}
+
+func (m *ProjectionManager) names() []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	rlt := make([]string, 0, len(m.projections))
+	for name := range m.projections {
+		rlt = append(rlt, name)
+	}
+	return rlt
+}
+
+// CatchUp 从检查点开始处理事件日志，直到追上最新的事件
+func (m *ProjectionManager) CatchUp(ctx context.Context, name string) error {
+	p, lock, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	return m.catchUp(ctx, p)
+}
+
+func (m *ProjectionManager) CatchUpAll(ctx context.Context) error {
+	for _, name := range m.names() {
+		if err := m.CatchUp(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rebuild 清空读模型并从头处理全部事件
+func (m *ProjectionManager) Rebuild(ctx context.Context, name string) error {
+	p, lock, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+
+	err = transactionIfPresent(ctx, m.txManager, func(txCtx context.Context) error {
+		if p.reset != nil {
+			if err := p.reset(txCtx); err != nil {
+				return err
+			}
+		}
+		return m.store.Save(txCtx, p.name, 0)
+	})
+	if err != nil {
+		return err
+	}
+	return m.catchUp(ctx, p)
+}
+
+// Listen 订阅领域事件，有新事件时触发所有投影追赶
+// 触发会合并，由单个协程串行追赶，不会为每个事件各起一次追赶
+// 事件日志在事务提交后才可见，建议同时用 Run 定时追赶兜底
+func (m *ProjectionManager) Listen(id string) {
+	m.listenOnce.Do(func() {
+		go m.worker()
+	})
+	RegisterAsyncEventSubscriber(id, func(ctx context.Context, event DomainEvent) {
+		select {
+		case m.trigger <- struct{}{}:
+		default:
+			// 已经有一次待执行的追赶，它会处理到这个事件
+		}
+	})
+}
+
+func (m *ProjectionManager) worker() {
+	for range m.trigger {
+		m.catchUpAllReporting(context.Background())
+	}
+}
+
+// Run 按 interval 定时追赶所有投影，直到 ctx 结束，追赶失败交给 SetErrorHandler 的回调，下一次继续
+func (m *ProjectionManager) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.catchUpAllReporting(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// catchUpAllReporting 逐个追赶投影，一个投影失败不影响其他投影
+func (m *ProjectionManager) catchUpAllReporting(ctx context.Context) {
+	for _, name := range m.names() {
+		if err := m.CatchUp(ctx, name); err != nil && ctx.Err() == nil {
+			m.onError(ctx, nil, fmt.Errorf("projection %s: %w", name, err))
+		}
+	}
+}
+
+func (m *ProjectionManager) catchUp(ctx context.Context, p *Projection) error {
+	if err := sequenceEventLog(ctx, m.log); err != nil {
+		return err
+	}
+	position, err := m.store.Load(ctx, p.name)
+	if err != nil {
+		return err
+	}
+	for {
+		events, err := m.log.Read(ctx, position, m.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		err = transactionIfPresent(ctx, m.txManager, func(txCtx context.Context) error {
+			for _, stored := range events {
+				if err := p.handle(txCtx, stored.Event); err != nil {
+					return err
+				}
+			}
+			return m.store.Save(txCtx, p.name, events[len(events)-1].Position)
+		})
+		if err != nil {
+			return err
+		}
+		position = events[len(events)-1].Position
+		if len(events) < m.batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package ddd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrSubscriberNotFound = errors.New("event subscriber not found")
+
+const defaultReplayBatchSize = 100
+
+type replayCtxKey struct{}
+
+// IsReplaying 订阅者可以据此判断当前是否在重放历史事件，从而跳过发短信之类不可重复的副作用
+func IsReplaying(ctx context.Context) bool {
+	rlt, _ := ctx.Value(replayCtxKey{}).(bool)
+	return rlt
+}
+
+type ReplayResult struct {
+	// Matched 满足查询条件并且订阅者会接收的事件数
+	Matched int
+	// Delivered 实际交给订阅者处理的事件数，DryRun 时为 0
+	Delivered int
+	// Events DryRun 时返回匹配到的事件，便于确认重放范围
+	Events       []*StoredEvent
+	LastPosition int64
+}
+
+// EventReplayer 从事件日志中读取历史事件，只投递给指定的订阅者
+type EventReplayer struct {
+	log       EventLog
+	batchSize int
+}
+
+func NewEventReplayer(log EventLog) *EventReplayer {
+	return &EventReplayer{
+		log:       log,
+		batchSize: defaultReplayBatchSize,
+	}
+}
+
+func (r *EventReplayer) SetBatchSize(batchSize int) {
+	if batchSize > 0 {
+		r.batchSize = batchSize
+	}
+}
+
+// Replay 按 query 从事件日志读取事件，按顺序同步交给 subscriberId 对应的订阅者，其他订阅者不受影响
+// 订阅者注册时的过滤条件同样生效，幂等去重不生效；dryRun 为 true 时只统计不投递
+func (r *EventReplayer) Replay(ctx context.Context, subscriberId string, query EventQuery, dryRun bool) (*ReplayResult, error) {
+	handler, ok := lookupEventHandler(subscriberId)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSubscriberNotFound, subscriberId)
+	}
+	if err := sequenceEventLog(ctx, r.log); err != nil {
+		return nil, err
+	}
+	ctx = contextWithValue(ctx, replayCtxKey{}, true)
+	rlt := &ReplayResult{LastPosition: query.AfterPosition}
+	// query.Limit 是读取事件总数的上限，batchSize 只用于分页
+	remaining := query.Limit
+	for {
+		query.Limit = r.batchSize
+		if remaining > 0 && remaining < query.Limit {
+			query.Limit = remaining
+		}
+		events, err := r.log.Query(ctx, query)
+		if err != nil {
+			return rlt, err
+		}
+		for _, stored := range events {
+			rlt.LastPosition = stored.Position
+			if handler.Filter(stored.Event) || (handler.predicate != nil && !handler.predicate(stored.Event)) {
+				continue
+			}
+			rlt.Matched++
+			if dryRun {
+				rlt.Events = append(rlt.Events, stored)
+				continue
+			}
+			handler.replayFn(eventHandlingContext(ctx, stored.Event), stored.Event)
+			rlt.Delivered++
+		}
+		if len(events) < query.Limit {
+			return rlt, nil
+		}
+		if remaining > 0 {
+			if remaining -= len(events); remaining == 0 {
+				return rlt, nil
+			}
+		}
+		query.AfterPosition = events[len(events)-1].Position
+	}
+}
@@ -22,8 +22,10 @@ type Repository interface {
 }
 
 type RepositoryManager struct {
-	pub   DomainEventPublisher
-	idGen IdGenerator
+	pub      DomainEventPublisher
+	idGen    IdGenerator
+	audit    AuditSink
+	eventLog EventLog
 }
 
 var RepositoryManagerName = "ddd:core:RepositoryManager"
@@ -39,6 +41,17 @@ func (r *RepositoryManager) Name() string {
 	return RepositoryManagerName
 }
 
+// SetAuditSink 保存聚合根后把改动写入审计记录，写入失败时保存返回错误
+func (r *RepositoryManager) SetAuditSink(sink AuditSink) {
+	r.audit = sink
+}
+
+// SetEventLog 保存聚合根时先把领域事件写入事件日志再发布，写入失败时保存返回错误
+// ctx 在事务中时事件日志与聚合根在同一个事务中提交或回滚
+func (r *RepositoryManager) SetEventLog(log EventLog) {
+	r.eventLog = log
+}
+
 func (r *RepositoryManager) NextIdentify(ctx context.Context) (int64, error) {
 	return r.idGen.Gen(ctx)
 }
@@ -46,7 +59,17 @@ func (r *RepositoryManager) NextIdentify(ctx context.Context) (int64, error) {
 func (r *RepositoryManager) AroundSave(ctx context.Context, agg Aggregate, doSave func(diff.AggregateDiff) error) error {
 	r.AssertPointer(agg)
 	if root, ok := agg.(AggregateRoot); ok {
-		for _, event := range root.Events() {
+		events := root.Events()
+		for _, event := range events {
+			fillAggregateMetadata(event, agg)
+			fillContextMetadata(ctx, event)
+		}
+		if r.eventLog != nil {
+			if err := r.eventLog.Append(ctx, events...); err != nil {
+				return err
+			}
+		}
+		for _, event := range events {
 			err := r.pub.Publish(ctx, event)
 			if err != nil {
 				return err
@@ -55,6 +78,11 @@ func (r *RepositoryManager) AroundSave(ctx context.Context, agg Aggregate, doSav
 		root.ClearEvents()
 		ad := root.Diff()
 		err := doSave(ad)
+		if err == nil && r.audit != nil {
+			if record, ok := newAuditRecord(ctx, root, ad); ok {
+				err = r.audit.Write(ctx, record)
+			}
+		}
 		if err == nil {
 			root.Attach(root)
 		}
@@ -121,6 +149,22 @@ type DBFactory interface {
 	LookupWriteDB(context.Context) (*gorm.DB, error)
 }
 
+// lookupDB 在事务中时返回事务的 DB，否则由 factory 自动选择主从
+func lookupDB(ctx context.Context, factory DBFactory) (*gorm.DB, error) {
+	if txCtx, ok := ctx.(*TransactionContext); ok && txCtx.InTransaction() {
+		return txCtx.TxDB(), nil
+	}
+	return factory.LookupDB(ctx)
+}
+
+// lookupWriteDB 在事务中时返回事务的 DB，否则获取写库
+func lookupWriteDB(ctx context.Context, factory DBFactory) (*gorm.DB, error) {
+	if txCtx, ok := ctx.(*TransactionContext); ok && txCtx.InTransaction() {
+		return txCtx.TxDB(), nil
+	}
+	return factory.LookupWriteDB(ctx)
+}
+
 type AggregateExporter func() Aggregate
 
 type DBRepositoryManager struct {
@@ -0,0 +1,422 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+type SagaStatus string
+
+const (
+	SagaRunning     SagaStatus = "RUNNING"
+	SagaCompleted   SagaStatus = "COMPLETED"
+	SagaCompensated SagaStatus = "COMPENSATED"
+	SagaFailed      SagaStatus = "FAILED" // 补偿本身失败，需要人工介入
+)
+
+var (
+	ErrSagaAlreadyRegistered = errors.New("saga already registered")
+	ErrSagaTimeout           = errors.New("saga timeout")
+)
+
+// SagaState 持久化的 saga 实例状态，同一类 saga 用 CorrelationId 区分实例
+type SagaState struct {
+	Id             int64      `gorm:"primaryKey;autoIncrement"`
+	SagaType       string     `gorm:"size:128;uniqueIndex:uk_saga_correlation"`
+	CorrelationId  string     `gorm:"size:128;uniqueIndex:uk_saga_correlation"`
+	Status         SagaStatus `gorm:"size:32;index"`
+	Data           string     `gorm:"type:text"`
+	CompletedSteps string     `gorm:"type:text"`
+	// Deadline 超时时间的 unix 秒，0 表示不超时
+	Deadline   int64     `gorm:"index"`
+	Error      string    `gorm:"type:text"`
+	CreateTime time.Time `gorm:"autoCreateTime"`
+	UpdateTime time.Time `gorm:"autoUpdateTime"`
+}
+
+func (SagaState) TableName() string {
+	return "ddd_saga_state"
+}
+
+// SagaRepository 持久化 saga 状态
+type SagaRepository interface {
+	// Find 找不到时返回 nil, nil
+	Find(ctx context.Context, sagaType, correlationId string) (*SagaState, error)
+	Save(ctx context.Context, state *SagaState) error
+	// FindExpired 查找已经超时但仍在运行中的 saga
+	FindExpired(ctx context.Context, now time.Time, limit int) ([]*SagaState, error)
+}
+
+type GormSagaRepository struct {
+	factory DBFactory
+}
+
+func NewGormSagaRepository(factory DBFactory) *GormSagaRepository {
+	return &GormSagaRepository{factory: factory}
+}
+
+func (r *GormSagaRepository) Find(ctx context.Context, sagaType, correlationId string) (*SagaState, error) {
+	db, err := lookupWriteDB(ctx, r.factory)
+	if err != nil {
+		return nil, err
+	}
+	if txCtx, ok := ctx.(*TransactionContext); ok && txCtx.InTransaction() {
+		// 同一个 saga 实例的事件串行处理
+		db = db.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	var states []*SagaState
+	err = db.Where("saga_type = ? AND correlation_id = ?", sagaType, correlationId).Limit(1).Find(&states).Error
+	if err != nil || len(states) == 0 {
+		return nil, err
+	}
+	return states[0], nil
+}
+
+func (r *GormSagaRepository) Save(ctx context.Context, state *SagaState) error {
+	db, err := lookupWriteDB(ctx, r.factory)
+	if err != nil {
+		return err
+	}
+	return db.Save(state).Error
+}
+
+func (r *GormSagaRepository) FindExpired(ctx context.Context, now time.Time, limit int) ([]*SagaState, error) {
+	db, err := lookupWriteDB(ctx, r.factory)
+	if err != nil {
+		return nil, err
+	}
+	var states []*SagaState
+	err = db.Where("status = ? AND deadline > 0 AND deadline <= ?", SagaRunning, now.Unix()).
+		Order("deadline").Limit(limit).Find(&states).Error
+	return states, err
+}
+
+// CommandBus saga 通过它向其他聚合发出命令
+type CommandBus interface {
+	Send(ctx context.Context, command interface{}) error
+}
+
+// SagaContext saga 处理函数的上下文
+type SagaContext struct {
+	ctx      context.Context
+	state    *SagaState
+	data     interface{}
+	steps    []string
+	commands CommandBus
+}
+
+func (c *SagaContext) Context() context.Context {
+	return c.ctx
+}
+
+func (c *SagaContext) CorrelationId() string {
+	return c.state.CorrelationId
+}
+
+// Data 返回 saga 的业务数据，类型为 NewSaga 时 newData 返回的类型，修改后会随状态一起保存
+func (c *SagaContext) Data() interface{} {
+	return c.data
+}
+
+func (c *SagaContext) Send(command interface{}) error {
+	return c.commands.Send(c.ctx, command)
+}
+
+// StepCompleted 记录已经完成的步骤，失败时按完成的逆序执行对应的补偿
+func (c *SagaContext) StepCompleted(step string) {
+	c.steps = append(c.steps, step)
+}
+
+// Complete 标记 saga 正常结束
+func (c *SagaContext) Complete() {
+	c.state.Status = SagaCompleted
+	c.state.Deadline = 0
+}
+
+// SetTimeout 重新设置超时时间，0 表示取消超时
+func (c *SagaContext) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		c.state.Deadline = 0
+		return
+	}
+	c.state.Deadline = time.Now().Add(timeout).Unix()
+}
+
+type SagaCorrelator func(event DomainEvent) string
+
+type SagaHandler func(sc *SagaContext, event DomainEvent) error
+
+type sagaEventHandler struct {
+	starter   bool
+	correlate SagaCorrelator
+	handle    SagaHandler
+}
+
+// SagaDefinition 描述一类 saga：由哪些事件启动、关注哪些事件、每个步骤如何补偿
+type SagaDefinition struct {
+	name          string
+	newData       func() interface{}
+	handlers      map[reflect.Type]*sagaEventHandler
+	compensations map[string]func(sc *SagaContext) error
+	timeout       time.Duration
+	onTimeout     func(sc *SagaContext) error
+}
+
+// NewSaga newData 返回保存 saga 业务数据的结构体指针，为空时不保存业务数据
+func NewSaga(name string, newData func() interface{}) *SagaDefinition {
+	return &SagaDefinition{
+		name:          name,
+		newData:       newData,
+		handlers:      make(map[reflect.Type]*sagaEventHandler),
+		compensations: make(map[string]func(sc *SagaContext) error),
+	}
+}
+
+func (d *SagaDefinition) Name() string {
+	return d.name
+}
+
+// Compensation 注册步骤的补偿动作
+func (d *SagaDefinition) Compensation(step string, fn func(sc *SagaContext) error) *SagaDefinition {
+	d.compensations[step] = fn
+	return d
+}
+
+// Timeout saga 启动后 timeout 内没有结束则触发 onTimeout，onTimeout 为空或者返回错误时执行补偿
+func (d *SagaDefinition) Timeout(timeout time.Duration, onTimeout func(sc *SagaContext) error) *SagaDefinition {
+	d.timeout = timeout
+	d.onTimeout = onTimeout
+	return d
+}
+
+// SagaStartedBy 类型为 T 的事件会启动一个新的 saga 实例，实例已存在时按普通事件处理
+func SagaStartedBy[T DomainEvent](d *SagaDefinition, correlate func(T) string, handler func(sc *SagaContext, event T) error) *SagaDefinition {
+	return addSagaHandler(d, true, correlate, handler)
+}
+
+// SagaOn 类型为 T 的事件交给已经存在的 saga 实例处理，找不到实例时忽略
+func SagaOn[T DomainEvent](d *SagaDefinition, correlate func(T) string, handler func(sc *SagaContext, event T) error) *SagaDefinition {
+	return addSagaHandler(d, false, correlate, handler)
+}
+
+func addSagaHandler[T DomainEvent](d *SagaDefinition, starter bool, correlate func(T) string, handler func(sc *SagaContext, event T) error) *SagaDefinition {
+	d.handlers[reflect.TypeOf((*T)(nil)).Elem()] = &sagaEventHandler{
+		starter: starter,
+		correlate: func(event DomainEvent) string {
+			return correlate(event.(T))
+		},
+		handle: func(sc *SagaContext, event DomainEvent) error {
+			return handler(sc, event.(T))
+		},
+	}
+	return d
+}
+
+const defaultSagaTimeoutBatch = 100
+
+// SagaManager 把领域事件关联到 saga 实例并驱动其状态流转
+type SagaManager struct {
+	repo      SagaRepository
+	commands  CommandBus
+	txManager *TransactionManager
+	onError   AsyncErrorHandler
+	sagas     map[string]*SagaDefinition
+	lock      sync.RWMutex
+}
+
+// NewSagaManager txManager 不为空时，每次事件处理和状态保存在同一个事务中
+func NewSagaManager(repo SagaRepository, commands CommandBus, txManager *TransactionManager) *SagaManager {
+	return &SagaManager{
+		repo:      repo,
+		commands:  commands,
+		txManager: txManager,
+		onError:   handleAsyncError,
+		sagas:     make(map[string]*SagaDefinition),
+	}
+}
+
+// SetErrorHandler 异步订阅的事件处理失败时回调，默认使用 SetAsyncErrorHandler 设置的回调
+func (m *SagaManager) SetErrorHandler(fn AsyncErrorHandler) {
+	if fn != nil {
+		m.onError = fn
+	}
+}
+
+// Register 注册 saga 并异步订阅领域事件
+func (m *SagaManager) Register(d *SagaDefinition) error {
+	m.lock.Lock()
+	if _, ok := m.sagas[d.name]; ok {
+		m.lock.Unlock()
+		return fmt.Errorf("%w: %s", ErrSagaAlreadyRegistered, d.name)
+	}
+	m.sagas[d.name] = d
+	m.lock.Unlock()
+
+	RegisterAsyncEventSubscriber("ddd:saga:"+d.name, func(ctx context.Context, event DomainEvent) {
+		if err := m.handle(ctx, d, event); err != nil {
+			m.onError(ctx, event, fmt.Errorf("saga %s: %w", d.name, err))
+		}
+	})
+	return nil
+}
+
+// Handle 把事件交给所有关注它的 saga 处理
+func (m *SagaManager) Handle(ctx context.Context, event DomainEvent) error {
+	m.lock.RLock()
+	sagas := make([]*SagaDefinition, 0, len(m.sagas))
+	for _, d := range m.sagas {
+		sagas = append(sagas, d)
+	}
+	m.lock.RUnlock()
+
+	for _, d := range sagas {
+		if err := m.handle(ctx, d, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *SagaManager) handle(ctx context.Context, d *SagaDefinition, event DomainEvent) error {
+	h, ok := d.handlers[reflect.TypeOf(event)]
+	if !ok {
+		return nil
+	}
+	correlationId := h.correlate(event)
+	if correlationId == "" {
+		return nil
+	}
+	return transactionIfPresent(ctx, m.txManager, func(txCtx context.Context) error {
+		state, err := m.repo.Find(txCtx, d.name, correlationId)
+		if err != nil {
+			return err
+		}
+		if state == nil {
+			if !h.starter {
+				return nil
+			}
+			state = &SagaState{
+				SagaType:      d.name,
+				CorrelationId: correlationId,
+				Status:        SagaRunning,
+			}
+			if d.timeout > 0 {
+				state.Deadline = time.Now().Add(d.timeout).Unix()
+			}
+		}
+		if state.Status != SagaRunning {
+			return nil
+		}
+		sc, err := m.newSagaContext(txCtx, d, state)
+		if err != nil {
+			return err
+		}
+		if err = h.handle(sc, event); err != nil {
+			m.compensate(sc, d, err)
+		}
+		return m.save(sc)
+	})
+}
+
+// CheckTimeouts 处理已经超时的 saga，需要定时调用
+func (m *SagaManager) CheckTimeouts(ctx context.Context) error {
+	states, err := m.repo.FindExpired(ctx, time.Now(), defaultSagaTimeoutBatch)
+	if err != nil {
+		return err
+	}
+	for _, expired := range states {
+		m.lock.RLock()
+		d, ok := m.sagas[expired.SagaType]
+		m.lock.RUnlock()
+		if !ok {
+			continue
+		}
+		err = transactionIfPresent(ctx, m.txManager, func(txCtx context.Context) error {
+			state, err := m.repo.Find(txCtx, expired.SagaType, expired.CorrelationId)
+			if err != nil || state == nil || state.Status != SagaRunning {
+				return err
+			}
+			sc, err := m.newSagaContext(txCtx, d, state)
+			if err != nil {
+				return err
+			}
+			deadline := state.Deadline
+			if d.onTimeout == nil {
+				m.compensate(sc, d, ErrSagaTimeout)
+			} else if err = d.onTimeout(sc); err != nil {
+				m.compensate(sc, d, err)
+			} else if state.Status == SagaRunning && state.Deadline == deadline {
+				// onTimeout 没有重新设置超时时间，避免反复触发
+				state.Deadline = 0
+			}
+			return m.save(sc)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *SagaManager) newSagaContext(ctx context.Context, d *SagaDefinition, state *SagaState) (*SagaContext, error) {
+	sc := &SagaContext{
+		ctx:      ctx,
+		state:    state,
+		commands: m.commands,
+	}
+	if d.newData != nil {
+		sc.data = d.newData()
+		if state.Data != "" {
+			if err := json.Unmarshal([]byte(state.Data), sc.data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if state.CompletedSteps != "" {
+		if err := json.Unmarshal([]byte(state.CompletedSteps), &sc.steps); err != nil {
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+// compensate 按完成的逆序执行补偿，补偿失败时停止并标记为 FAILED
+func (m *SagaManager) compensate(sc *SagaContext, d *SagaDefinition, cause error) {
+	sc.state.Error = cause.Error()
+	sc.state.Deadline = 0
+	for len(sc.steps) > 0 {
+		step := sc.steps[len(sc.steps)-1]
+		if fn, ok := d.compensations[step]; ok {
+			if err := fn(sc); err != nil {
+				sc.state.Status = SagaFailed
+				sc.state.Error = fmt.Sprintf("%s; compensate %s failed: %v", cause.Error(), step, err)
+				return
+			}
+		}
+		sc.steps = sc.steps[:len(sc.steps)-1]
+	}
+	sc.state.Status = SagaCompensated
+}
+
+func (m *SagaManager) save(sc *SagaContext) error {
+	if sc.data != nil {
+		data, err := json.Marshal(sc.data)
+		if err != nil {
+			return err
+		}
+		sc.state.Data = string(data)
+	}
+	steps, err := json.Marshal(sc.steps)
+	if err != nil {
+		return err
+	}
+	sc.state.CompletedSteps = string(steps)
+	return m.repo.Save(sc.ctx, sc.state)
+}
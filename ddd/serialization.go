@@ -0,0 +1,241 @@
+package ddd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/zhenyu888/ddd-core/ebus"
+	"github.com/zhenyu888/ddd-core/funcs"
+)
+
+var (
+	ErrEventTypeNotRegistered     = errors.New("event type not registered")
+	ErrEventTypeAlreadyRegistered = errors.New("event type already registered with another go type")
+)
+
+// EventTyper 领域事件可以自定义稳定的类型名，未实现时使用注册时指定的名字
+type EventTyper interface {
+	EventType() string
+}
+
+// EventRegistry 维护稳定的事件类型名与 Go 类型之间的映射，以及旧版本负载的升级转换
+type EventRegistry struct {
+	nameToType map[string]reflect.Type
+	typeToName map[reflect.Type]string
+	versions   map[string]int
+	upcasters  map[string]map[int]Upcaster
+	lock       sync.RWMutex
+}
+
+func NewEventRegistry() *EventRegistry {
+	return &EventRegistry{
+		nameToType: make(map[string]reflect.Type),
+		typeToName: make(map[reflect.Type]string),
+		versions:   make(map[string]int),
+		upcasters:  make(map[string]map[int]Upcaster),
+	}
+}
+
+// Register 注册事件类型，name 为空时使用 EventTyper 或者结构体名
+func (r *EventRegistry) Register(name string, sample DomainEvent) error {
+	if name == "" {
+		name = defaultEventTypeName(sample)
+	}
+	t := reflect.TypeOf(sample)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if registered, ok := r.nameToType[name]; ok && registered != t {
+		return fmt.Errorf("%w: %s", ErrEventTypeAlreadyRegistered, name)
+	}
+	r.nameToType[name] = t
+	r.typeToName[t] = name
+	r.versions[name] = EventSchemaVersion(sample)
+	return nil
+}
+
+// NameOf 返回事件的类型名，优先使用注册时的名字，未注册的类型才使用 EventTyper
+func (r *EventRegistry) NameOf(event DomainEvent) (string, error) {
+	r.lock.RLock()
+	name, ok := r.typeToName[reflect.TypeOf(event)]
+	r.lock.RUnlock()
+	if ok {
+		return name, nil
+	}
+	if typer, ok := event.(EventTyper); ok {
+		return typer.EventType(), nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrEventTypeNotRegistered, reflect.TypeOf(event))
+}
+
+// TypeOf 返回类型名对应的 Go 类型
+func (r *EventRegistry) TypeOf(name string) (reflect.Type, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if t, ok := r.nameToType[name]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrEventTypeNotRegistered, name)
+}
+
+func defaultEventTypeName(event DomainEvent) string {
+	if typer, ok := event.(EventTyper); ok {
+		return typer.EventType()
+	}
+	return funcs.ReflectValueName(event)
+}
+
+var defaultEventRegistry = NewEventRegistry()
+
+// DefaultEventRegistry 返回全局的事件类型注册表
+func DefaultEventRegistry() *EventRegistry {
+	return defaultEventRegistry
+}
+
+// RegisterEventType 在全局注册表中注册事件类型，一般在 init 中调用
+func RegisterEventType(name string, sample DomainEvent) {
+	if err := defaultEventRegistry.Register(name, sample); err != nil {
+		panic(err)
+	}
+}
+
+// EventCodec 事件负载的编解码，不限定具体格式，JSON、protobuf 都可以实现
+type EventCodec interface {
+	ContentType() string
+	Marshal(event DomainEvent) ([]byte, error)
+	// Unmarshal 把 data 解码到 target，target 一定是指针
+	Unmarshal(data []byte, target interface{}) error
+}
+
+type jsonEventCodec struct{}
+
+func NewJSONEventCodec() EventCodec {
+	return &jsonEventCodec{}
+}
+
+func (c *jsonEventCodec) ContentType() string {
+	return "application/json"
+}
+
+func (c *jsonEventCodec) Marshal(event DomainEvent) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+func (c *jsonEventCodec) Unmarshal(data []byte, target interface{}) error {
+	return json.Unmarshal(data, target)
+}
+
+// SerializedEvent 序列化后的领域事件，可以直接写入发件箱、事件存储或者发送到消息队列
+type SerializedEvent struct {
+	EventId       string        `json:"eventId"`
+	EventType     string        `json:"eventType"`
+	SchemaVersion int           `json:"schemaVersion"`
+	OccurredOn    int64         `json:"occurredOn"`
+	ContentType   string        `json:"contentType"`
+	Metadata      EventMetadata `json:"metadata"`
+	Payload       []byte        `json:"payload"`
+}
+
+type EventSerializer struct {
+	registry *EventRegistry
+	codec    EventCodec
+}
+
+// NewEventSerializer registry 为空时使用全局注册表，codec 为空时使用 JSON
+func NewEventSerializer(registry *EventRegistry, codec EventCodec) *EventSerializer {
+	if registry == nil {
+		registry = defaultEventRegistry
+	}
+	if codec == nil {
+		codec = NewJSONEventCodec()
+	}
+	return &EventSerializer{
+		registry: registry,
+		codec:    codec,
+	}
+}
+
+func (s *EventSerializer) Serialize(event DomainEvent) (*SerializedEvent, error) {
+	name, err := s.registry.NameOf(event)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := s.codec.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	rlt := &SerializedEvent{
+		EventId:       event.GetEventId(),
+		EventType:     name,
+		SchemaVersion: EventSchemaVersion(event),
+		OccurredOn:    event.GetOccurredOn(),
+		ContentType:   s.codec.ContentType(),
+		Payload:       payload,
+	}
+	if holder, ok := event.(DomainEventMetadata); ok {
+		rlt.Metadata = holder.GetMetadata()
+	}
+	return rlt, nil
+}
+
+// Deserialize 反序列化事件，旧版本的负载会先经过注册的 Upcaster 升级到当前结构
+func (s *EventSerializer) Deserialize(serialized *SerializedEvent) (DomainEvent, error) {
+	t, err := s.registry.TypeOf(serialized.EventType)
+	if err != nil {
+		return nil, err
+	}
+	payload, version, err := s.registry.Upcast(serialized.EventType, serialized.SchemaVersion, serialized.Payload)
+	if err != nil {
+		return nil, err
+	}
+	isPtr := t.Kind() == reflect.Ptr
+	if isPtr {
+		t = t.Elem()
+	}
+	target := reflect.New(t)
+	if err = s.codec.Unmarshal(payload, target.Interface()); err != nil {
+		return nil, err
+	}
+	if !isPtr {
+		target = target.Elem()
+	}
+	rlt := target.Interface().(DomainEvent)
+	if holder, ok := rlt.(DomainEventMetadata); ok {
+		metadata := holder.GetMetadata()
+		metadata.SchemaVersion = version
+		holder.SetMetadata(metadata)
+	}
+	return rlt, nil
+}
+
+// EbusCodec 把序列化器适配成 ebus.Codec，可以给 ebus.NewDurableDispatcher 使用
+func (s *EventSerializer) EbusCodec() ebus.Codec {
+	return &serializerCodec{serializer: s}
+}
+
+type serializerCodec struct {
+	serializer *EventSerializer
+}
+
+func (c *serializerCodec) Encode(event interface{}) ([]byte, error) {
+	de, ok := event.(DomainEvent)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrEventTypeNotRegistered, event)
+	}
+	serialized, err := c.serializer.Serialize(de)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(serialized)
+}
+
+func (c *serializerCodec) Decode(data []byte) (interface{}, error) {
+	var serialized SerializedEvent
+	if err := json.Unmarshal(data, &serialized); err != nil {
+		return nil, err
+	}
+	return c.serializer.Deserialize(&serialized)
+}
@@ -1,7 +1,10 @@
 package ddd
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -11,7 +14,38 @@ import (
 
 const traceTag = "trace"
 
+// DiffTracer 由 ddd-tracegen 生成，Trace 优先使用生成的代码对比
+type DiffTracer interface {
+	TraceDiff(snapshot Aggregate) diff.AggregateDiff
+}
+
+// SnapshotCopier 由 ddd-tracegen 生成，Attach 优先使用生成的代码复制快照
+type SnapshotCopier interface {
+	CopySnapshot() Aggregate
+}
+
+// Trace 对比聚合根与快照，字段通过 trace tag 分组：
+//
+//	`trace:"name"`          相同 name 的字段为一组，改动记录在 GetDiff(name)；
+//	                        组内只有一个 slice 字段时记录在 GetListDiff(name)，
+//	                        只有一个 map 字段时按 key 记录在 GetMapDiff(name)
+//	不写 tag                所有没有 tag 的字段为一组，改动记录在 SelfDiff()
+//	`trace:"-"`             忽略该字段
+//
+// name 后面可以跟逗号分隔的选项，不需要分组时 name 可以省略，比如 `trace:",deep"`：
+//
+//	deep                    递归对比嵌套的结构体，按 address.city 这样的路径记录改动
+//	depth=N                 最多递归 N 层
+//	key=<Field>             slice 元素用 Field 字段作为标识，元素没有实现 Entity 时使用
+//	ordered                 slice 按位置对比，同一位置的元素不同视为修改
+//
+// 值的比较使用 diff.Equal，可以通过 diff.RegisterComparer 或实现 diff.Equaler 自定义相等判断
+//
+// 没有 ordered 时 slice 按最长公共子序列对比，ListDiff.Operations() 给出插入/删除/移动/替换操作
 func Trace(aggregate, snapshot Aggregate) diff.AggregateDiff {
+	if tracer, ok := aggregate.(DiffTracer); ok {
+		return tracer.TraceDiff(snapshot)
+	}
 	builder := diff.NewAggregateDiffBuilder()
 	if snapshot == nil {
 		builder.SetSelfChanged(true)
@@ -23,148 +57,350 @@ func Trace(aggregate, snapshot Aggregate) diff.AggregateDiff {
 		builder.SetSelfChanged(true)
 		return builder.Build()
 	}
-	// slice 和 map 类型的字段先暂时不做diff
+	// slice 和 map 类型的字段最后单独做 ListDiff/MapDiff
 	sliceField := make(map[string][]int)
 	mapField := make(map[string][]int)
 	for i, n := 0, v1.NumField(); i < n; i++ {
 		fieldType := v1.Type().Field(i)
-		if fieldType.Name == "AggregateManager" || fieldType.Name == "MixModel" {
+		// 未导出的字段不会被快照复制
+		if fieldType.PkgPath != "" || fieldType.Name == "AggregateManager" || fieldType.Name == "MixModel" {
 			continue
 		}
 
-		fieldTag := fieldType.Tag.Get(traceTag)
-		// 所有没有tag的字段看做一个整体
-		if !isValidTag(fieldTag) {
-			if !builder.IsSelfChanged() {
-				selfChanged := !reflect.DeepEqual(v1.Field(i).Interface(), v2.Field(i).Interface())
-				builder.SetSelfChanged(selfChanged)
-			}
+		tagName, opts := parseTag(fieldType.Tag.Get(traceTag))
+		if tagName == "-" {
 			continue
 		}
-		// 所有具有相同tag的字段看做一个整体
-		tagName, _ := parseTag(fieldTag)
-		if changed := builder.GetDiff(tagName); changed.IsChanged() {
+		depth := opts.depth()
+		// 所有没有tag的字段看做一个整体，trace:",deep" 这种只有选项的tag同样归为一组
+		if !isValidTag(tagName) {
+			for _, change := range traceField("", fieldType, v1.Field(i), v2.Field(i), depth) {
+				builder.AppendSelfChange(change)
+			}
 			continue
 		}
-
+		// 所有具有相同tag的字段看做一个整体，json 中不存在的 slice/map 字段整体对比
 		fieldV1 := v1.Field(i)
-		switch fieldV1.Kind() {
-		case reflect.Array, reflect.Slice:
-			sliceField[tagName] = append(sliceField[tagName], i)
-		case reflect.Map:
-			mapField[tagName] = append(mapField[tagName], i)
-		default:
-			changed := !reflect.DeepEqual(fieldV1.Interface(), v2.Field(i).Interface())
-			if changed {
-				builder.PutDiff(tagName, diff.NewDiff(changed))
+		if !jsonHidden(fieldType) {
+			switch fieldV1.Kind() {
+			case reflect.Array, reflect.Slice:
+				sliceField[tagName] = append(sliceField[tagName], i)
+				continue
+			case reflect.Map:
+				mapField[tagName] = append(mapField[tagName], i)
+				continue
 			}
 		}
+		for _, change := range traceField("", fieldType, fieldV1, v2.Field(i), depth) {
+			builder.AppendChange(tagName, change)
+		}
 	}
-	fillListDiff(builder, v1, v2, sliceField)
-	fillListDiff(builder, v1, v2, mapField)
+	fillListDiff(builder, v1, v2, sliceField, mapField)
+	fillListDiff(builder, v1, v2, mapField, sliceField)
 	return builder.Build()
 }
 
-func fillListDiff(builder diff.AggregateDiffBuilder, v1, v2 reflect.Value, tagToIdxs map[string][]int) {
+// maxTraceDepth deep 选项最多递归的层数，防止指针成环
+const maxTraceDepth = 32
+
+// traceValue 对比 x（当前值）和 y（快照），depth 大于 0 时递归进入结构体，按路径返回每个叶子字段的改动
+func traceValue(path string, x, y reflect.Value, depth int) []diff.FieldChange {
+	if depth <= 0 {
+		if path == "" && embeddedExpandable(x, y) {
+			// 没有 json tag 的匿名嵌入结构体在 json 中被展开，逐个对比其中的字段，保证路径与 json 一致
+			return traceValue(path, x, y, 1)
+		}
+		if diff.Equal(x.Interface(), y.Interface()) {
+			return nil
+		}
+		change := diff.FieldChange{Path: path, OldValue: y.Interface(), NewValue: x.Interface()}
+		if path == "" {
+			// 整体对比匿名嵌入的字段，结构体无法展开时在 json 中没有对应的路径
+			t := x.Type()
+			if t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			change.Path, change.Hidden = t.Name(), t.Kind() == reflect.Struct
+		}
+		return []diff.FieldChange{change}
+	}
+	if diff.HasCustomEqual(x.Type()) {
+		return traceValue(path, x, y, 0)
+	}
+	switch x.Kind() {
+	case reflect.Ptr:
+		if x.IsNil() || y.IsNil() {
+			return traceValue(path, x, y, 0)
+		}
+		return traceValue(path, x.Elem(), y.Elem(), depth)
+	case reflect.Struct:
+		var rlt []diff.FieldChange
+		for i, n := 0, x.NumField(); i < n; i++ {
+			field := x.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if name, _ := parseTag(field.Tag.Get(traceTag)); name == "-" {
+				continue
+			}
+			rlt = append(rlt, traceField(path, field, x.Field(i), y.Field(i), depth-1)...)
+		}
+		return rlt
+	}
+	return traceValue(path, x, y, 0)
+}
+
+// traceField 对比结构体中的字段，json:"-" 的字段在 json 中没有对应的路径，改动标记为 Hidden
+func traceField(parent string, field reflect.StructField, x, y reflect.Value, depth int) []diff.FieldChange {
+	changes := traceValue(fieldPath(parent, field), x, y, depth)
+	if jsonHidden(field) {
+		for i := range changes {
+			changes[i].Hidden = true
+		}
+	}
+	return changes
+}
+
+func jsonHidden(field reflect.StructField) bool {
+	return field.Tag.Get("json") == "-"
+}
+
+// embeddedExpandable 匿名嵌入的字段是结构体或者两边都不为 nil 的结构体指针，并且没有自定义的比较
+func embeddedExpandable(x, y reflect.Value) bool {
+	if diff.HasCustomEqual(x.Type()) {
+		return false
+	}
+	if x.Kind() == reflect.Ptr {
+		if x.IsNil() || y.IsNil() {
+			return false
+		}
+		x = x.Elem()
+	}
+	return x.Kind() == reflect.Struct && !diff.HasCustomEqual(x.Type())
+}
+
+// MergeAggregate 三路合并聚合根，以 ours 为基础应用 theirs 相对 base 的改动，规则见 diff.Merge
+// 合并结果是新的副本，需要重新 Attach 快照
+func MergeAggregate[T Aggregate](base, ours, theirs T) (T, []diff.Conflict, error) {
+	return diff.Merge(base, ours, theirs, func(current, snapshot interface{}) diff.AggregateDiff {
+		return Trace(current.(Aggregate), snapshot.(Aggregate))
+	})
+}
+
+// TraceField 对比单个字段，options 为 trace tag 中逗号后面的选项，供生成的代码使用
+func TraceField(path string, x, y interface{}, options string) []diff.FieldChange {
+	vX, vY := reflect.ValueOf(x), reflect.ValueOf(y)
+	if !vX.IsValid() || !vY.IsValid() {
+		if vX.IsValid() == vY.IsValid() {
+			return nil
+		}
+		return []diff.FieldChange{{Path: path, OldValue: y, NewValue: x}}
+	}
+	return traceValue(path, vX, vY, tagOptions(options).depth())
+}
+
+// TraceList 对比 slice 字段，options 为 trace tag 中逗号后面的选项，供生成的代码使用
+func TraceList(path string, x, y interface{}, options string) diff.ListDiff {
+	return makeListDiff(path, reflect.ValueOf(x), reflect.ValueOf(y), tagOptions(options))
+}
+
+// TraceMap 对比 map 字段，供生成的代码使用
+func TraceMap(path string, x, y interface{}) diff.MapDiff {
+	return makeMapDiff(path, reflect.ValueOf(x), reflect.ValueOf(y))
+}
+
+// fieldPath 字段的改动路径，优先使用 json tag 名，匿名嵌入且没有 json tag 的字段跟 json 一样展开到上一层
+func fieldPath(parent string, field reflect.StructField) string {
+	name := field.Tag.Get("json")
+	if idx := strings.Index(name, ","); idx != -1 {
+		name = name[:idx]
+	}
+	if name == "" || jsonHidden(field) {
+		if field.Anonymous {
+			return parent
+		}
+		name = field.Name
+	}
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func fillListDiff(builder diff.AggregateDiffBuilder, v1, v2 reflect.Value, tagToIdxs, otherListTags map[string][]int) {
 	for tagName, indexSlice := range tagToIdxs {
 		if len(indexSlice) == 0 {
 			continue
 		}
-		if changed := builder.GetDiff(tagName); changed.IsChanged() {
-			// 如果当前tag已经标识为有改动，则不需要再做diff
-			if changed.IsChanged() {
+		// 同一个tag下只有一个 Slice/Map 字段时才做ListDiff/MapDiff，否则整体对比
+		if len(indexSlice) == 1 && len(otherListTags[tagName]) == 0 {
+			idx := indexSlice[0]
+			fieldType := v1.Type().Field(idx)
+			if fieldType.Type.Kind() == reflect.Map {
+				builder.PutMapDiff(tagName, makeMapDiff(fieldPath("", fieldType), v1.Field(idx), v2.Field(idx)))
 				continue
-			} else {
-				// Slice/Map 字段的tag如果跟其他字段的tag重复了，也不会ListDiff
-				for _, idx := range indexSlice {
-					if !reflect.DeepEqual(v1.Field(idx).Interface(), v2.Field(idx).Interface()) {
-						builder.PutDiff(tagName, diff.NewDiff(true))
-						break
-					}
-				}
 			}
-		} else {
-			if len(indexSlice) > 1 {
-				for _, idx := range indexSlice {
-					if !reflect.DeepEqual(v1.Field(idx).Interface(), v2.Field(idx).Interface()) {
-						builder.PutDiff(tagName, diff.NewDiff(true))
-						break
-					}
-				}
-			} else {
-				idx := indexSlice[0]
-				builder.PutListDiff(tagName, makeListDiff(v1.Field(idx), v2.Field(idx)))
+			_, opts := parseTag(fieldType.Tag.Get(traceTag))
+			builder.PutListDiff(tagName, makeListDiff(fieldPath("", fieldType), v1.Field(idx), v2.Field(idx), opts))
+			continue
+		}
+		for _, idx := range indexSlice {
+			for _, change := range traceValue(fieldPath("", v1.Type().Field(idx)), v1.Field(idx), v2.Field(idx), 0) {
+				builder.AppendChange(tagName, change)
 			}
 		}
 	}
 }
 
-func makeListDiff(x, y reflect.Value) diff.ListDiff {
-	builder := diff.NewListDiffBuilder()
-	switch x.Kind() {
-	case reflect.Slice, reflect.Array:
-		xMap := make(map[int64]interface{})
-		xSlice := make([]interface{}, 0, x.Len())
-		yMap := make(map[int64]interface{})
-		ySlice := make([]interface{}, 0, y.Len())
-		for i := 0; i < x.Len(); i++ {
-			idxV := x.Index(i).Interface()
-			if e, ok := idxV.(Entity); ok {
-				xMap[e.Identifier()] = e
+func makeListDiff(path string, x, y reflect.Value, opts tagOptions) diff.ListDiff {
+	builder := diff.NewListDiffBuilder().SetPath(path).SetFromEmpty(y.Len() == 0)
+	xSlice := listElements(x)
+	ySlice := listElements(y)
+	if opts.contains("ordered") {
+		makeOrderedListDiff(builder, xSlice, ySlice)
+		return builder.Build()
+	}
+	keyField, _ := opts.value("key")
+	xKeys, xOk := listElementKeys(xSlice, keyField)
+	yKeys, yOk := listElementKeys(ySlice, keyField)
+	if !xOk || !yOk {
+		// 元素没有标识时按值做序列对比，值相同的元素视为同一个元素
+		ops := diff.SequenceOperations(ySlice, xSlice, diff.Equal, nil)
+		for _, op := range ops {
+			switch op.Type {
+			case diff.ListOpInsert:
+				builder.AppendAdded(op.Value)
+			case diff.ListOpDelete:
+				builder.AppendRemoved(op.Value)
 			}
-			xSlice = append(xSlice, idxV)
 		}
-		for i := 0; i < y.Len(); i++ {
-			idxV := y.Index(i).Interface()
-			if e, ok := idxV.(Entity); ok {
-				yMap[e.Identifier()] = e
-			}
-			ySlice = append(ySlice, idxV)
+		return builder.SetOperations(ops).Build()
+	}
+	yByKey := make(map[interface{}]interface{}, len(ySlice))
+	for idx, v := range ySlice {
+		yByKey[yKeys[idx]] = v
+	}
+	xByKey := make(map[interface{}]bool, len(xSlice))
+	for idx, vX := range xSlice {
+		xByKey[xKeys[idx]] = true
+		if vY, ok := yByKey[xKeys[idx]]; !ok {
+			builder.AppendAdded(vX)
+		} else if !diff.Equal(vX, vY) {
+			builder.AppendModifiedWithOld(vY, vX)
 		}
-		if len(xMap) == 0 || len(yMap) == 0 {
-			for _, v := range xSlice {
-				builder.AppendAdded(v)
-			}
-			for _, v := range ySlice {
-				builder.AppendRemoved(v)
-			}
-		} else {
-			for kX, vX := range xMap {
-				if vY, ok := yMap[kX]; !ok {
-					builder.AppendAdded(vX)
-				} else if !reflect.DeepEqual(vX, vY) {
-					builder.AppendModified(vX)
-				}
-			}
-			for kY, vY := range yMap {
-				if _, ok := xMap[kY]; !ok {
-					builder.AppendRemoved(vY)
-				}
-			}
+	}
+	for idx, vY := range ySlice {
+		if !xByKey[yKeys[idx]] {
+			builder.AppendRemoved(vY)
 		}
-	case reflect.Map:
-		iterX := x.MapRange()
-		for iterX.Next() {
-			kX := iterX.Key()
-			vX := iterX.Value()
-			if vY := y.MapIndex(kX); vY.IsZero() {
-				builder.AppendAdded(vX.Interface())
-			} else if !reflect.DeepEqual(vX.Interface(), vY.Interface()) {
-				builder.AppendModified(vX.Interface())
-			}
+	}
+	return builder.SetOperations(diff.SequenceOperationsByKey(ySlice, xSlice, yKeys, xKeys, diff.Equal)).Build()
+}
+
+// makeMapDiff 按 key 对比两个 map，结果按 key 的字符串形式排序
+func makeMapDiff(path string, x, y reflect.Value) diff.MapDiff {
+	builder := diff.NewMapDiffBuilder(path).SetFromEmpty(y.Len() == 0)
+	for _, k := range sortedMapKeys(x) {
+		vX := x.MapIndex(k)
+		if vY := y.MapIndex(k); !vY.IsValid() {
+			builder.AppendAdded(k.Interface(), vX.Interface())
+		} else if !diff.Equal(vX.Interface(), vY.Interface()) {
+			builder.AppendModified(k.Interface(), vY.Interface(), vX.Interface())
 		}
-		iterY := y.MapRange()
-		for iterY.Next() {
-			kY := iterY.Key()
-			vY := iterY.Value()
-			if vX := x.MapIndex(kY); vX.IsZero() {
-				builder.AppendRemoved(vY.Interface())
-			}
+	}
+	for _, k := range sortedMapKeys(y) {
+		if !x.MapIndex(k).IsValid() {
+			builder.AppendRemoved(k.Interface(), y.MapIndex(k).Interface())
 		}
 	}
 	return builder.Build()
 }
 
+func sortedMapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.SliceStable(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	return keys
+}
+
+func listElements(v reflect.Value) []interface{} {
+	rlt := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		rlt = append(rlt, v.Index(i).Interface())
+	}
+	return rlt
+}
+
+// makeOrderedListDiff 按位置逐个对比，同一位置的值不同视为修改
+func makeOrderedListDiff(builder diff.ListDiffBuilder, xSlice, ySlice []interface{}) {
+	var ops []diff.ListOp
+	for i := len(ySlice) - 1; i >= len(xSlice); i-- {
+		builder.AppendRemoved(ySlice[i])
+		ops = append(ops, diff.ListOp{Type: diff.ListOpDelete, Index: i, Value: ySlice[i]})
+	}
+	for i, vX := range xSlice {
+		if i >= len(ySlice) {
+			builder.AppendAdded(vX)
+			ops = append(ops, diff.ListOp{Type: diff.ListOpInsert, Index: i, Value: vX})
+		} else if !diff.Equal(vX, ySlice[i]) {
+			builder.AppendModifiedWithOld(ySlice[i], vX)
+			ops = append(ops, diff.ListOp{Type: diff.ListOpReplace, Index: i, Value: vX})
+		}
+	}
+	builder.SetOperations(ops)
+}
+
+// listElementKeys 返回每个元素的标识，有元素取不到标识时返回 false
+func listElementKeys(elements []interface{}, keyField string) ([]interface{}, bool) {
+	rlt := make([]interface{}, 0, len(elements))
+	for _, element := range elements {
+		key, ok := elementKey(element, keyField)
+		if !ok {
+			return nil, false
+		}
+		rlt = append(rlt, key)
+	}
+	return rlt, true
+}
+
+// elementKey keyField 不为空时取该字段作为标识，否则要求元素实现 Entity
+func elementKey(element interface{}, keyField string) (interface{}, bool) {
+	if keyField == "" {
+		e, ok := element.(Entity)
+		if !ok {
+			return nil, false
+		}
+		return e.Identifier(), true
+	}
+	v := reflect.ValueOf(element)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+	key := lookupKeyField(v, keyField)
+	if !key.IsValid() || !key.CanInterface() || !key.Type().Comparable() {
+		return nil, false
+	}
+	return key.Interface(), true
+}
+
+// lookupKeyField 按字段名查找，找不到时按 json tag 中的名称查找
+func lookupKeyField(v reflect.Value, name string) reflect.Value {
+	if f := v.FieldByName(name); f.IsValid() {
+		return f
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if jsonName, _ := parseTag(field.Tag.Get("json")); jsonName == name {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
 // copied from json
 // tagOptions is the string following a comma in a struct field's "trace"
 // tag, or the empty string. It does not include the leading comma.
@@ -203,6 +439,36 @@ func (o tagOptions) contains(optionName string) bool {
 	return false
 }
 
+// value 返回 name=value 形式的选项值
+func (o tagOptions) value(optionName string) (string, bool) {
+	s := string(o)
+	for s != "" {
+		var next string
+		i := strings.Index(s, ",")
+		if i >= 0 {
+			s, next = s[:i], s[i+1:]
+		}
+		if strings.HasPrefix(s, optionName+"=") {
+			return s[len(optionName)+1:], true
+		}
+		s = next
+	}
+	return "", false
+}
+
+// depth 字段递归对比的层数：deep 不限层数，depth=N 最多 N 层，默认为 0 即整体对比
+func (o tagOptions) depth() int {
+	if o.contains("deep") {
+		return maxTraceDepth
+	}
+	if v, ok := o.value("depth"); ok {
+		if depth, err := strconv.Atoi(v); err == nil && depth > 0 {
+			return depth
+		}
+	}
+	return 0
+}
+
 func isValidTag(s string) bool {
 	if s == "" {
 		return false
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
@@ -45,6 +46,49 @@ type TransactionContext struct {
 	ctx    context.Context
 	tx     *gorm.DB
 	parent *TransactionContext
+	hooks  *txHooks
+}
+
+// txHooks 同一个事务中所有 TransactionContext 共享的提交回调
+type txHooks struct {
+	afterCommit []func(ctx context.Context)
+	lock        sync.Mutex
+}
+
+func (h *txHooks) append(fn func(ctx context.Context)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.afterCommit = append(h.afterCommit, fn)
+}
+
+func (h *txHooks) len() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return len(h.afterCommit)
+}
+
+func (h *txHooks) truncate(n int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if n < len(h.afterCommit) {
+		h.afterCommit = h.afterCommit[:n]
+	}
+}
+
+func (h *txHooks) drain() []func(ctx context.Context) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	rlt := h.afterCommit
+	h.afterCommit = nil
+	return rlt
+}
+
+func newRootTransactionContext(ctx context.Context, tx *gorm.DB) *TransactionContext {
+	return &TransactionContext{
+		ctx:   ctx,
+		tx:    tx,
+		hooks: &txHooks{},
+	}
 }
 
 func (c *TransactionContext) Deadline() (deadline time.Time, ok bool) {
@@ -95,12 +139,28 @@ func (c *TransactionContext) Session(config *gorm.Session) *TransactionContext {
 		ctx:    c.ctx,
 		tx:     c.tx.Session(config),
 		parent: c,
+		hooks:  c.hooks,
 	}
 }
 
+// AfterCommit 注册事务提交成功后执行的回调，事务回滚时不会执行；当前不在事务中时立即执行
+func (c *TransactionContext) AfterCommit(fn func(ctx context.Context)) {
+	if !c.InTransaction() {
+		fn(c.ctx)
+		return
+	}
+	if c.hooks == nil {
+		c.hooks = &txHooks{}
+	}
+	c.hooks.append(fn)
+}
+
 func (c *TransactionContext) Rollback() {
 	if c.InTransaction() {
 		c.tx.Rollback()
+		if c.hooks != nil {
+			c.hooks.drain()
+		}
 	}
 }
 
@@ -109,7 +169,14 @@ func (c *TransactionContext) Commit() error {
 		return ErrNotInTransaction
 	}
 	if c.IsRoot() {
-		return c.tx.Commit().Error
+		if err := c.tx.Commit().Error; err != nil {
+			return err
+		}
+		if c.hooks != nil {
+			for _, fn := range c.hooks.drain() {
+				fn(c.ctx)
+			}
+		}
 	}
 	return nil
 }
@@ -173,11 +240,19 @@ func (m *TransactionManager) withNestedPropagation(ctx context.Context, bizFn fu
 		panicked := true
 		db := txCtx.TxDB()
 		if !db.DisableNestedTransaction {
+			hookMark := -1
+			if txCtx.hooks != nil {
+				hookMark = txCtx.hooks.len()
+			}
 			err = db.SavePoint(fmt.Sprintf("sp%p", bizFn)).Error
 			defer func() {
 				// Make sure to rollback when panic, Block error or Commit error
 				if panicked || err != nil {
 					db.RollbackTo(fmt.Sprintf("sp%p", bizFn))
+					// 回滚到保存点时，丢弃保存点之后注册的提交回调
+					if hookMark >= 0 {
+						txCtx.hooks.truncate(hookMark)
+					}
 				}
 			}()
 		}
@@ -208,12 +283,10 @@ func (m *TransactionManager) withRequiredPropagation(ctx context.Context, bizFn
 			return err
 		}
 		if !ok {
-			txCtx = &TransactionContext{
-				ctx: ctx,
-				tx:  db.Begin(),
-			}
+			txCtx = newRootTransactionContext(ctx, db.Begin())
 		} else {
 			txCtx.tx = db.Begin()
+			txCtx.hooks = &txHooks{}
 		}
 		defer func() {
 			if panicked || err != nil {
@@ -244,10 +317,7 @@ func (m *TransactionManager) withRequiresNewPropagation(ctx context.Context, biz
 	if err != nil {
 		return err
 	}
-	txCtx := &TransactionContext{
-		ctx: ctx,
-		tx:  db.Begin(),
-	}
+	txCtx := newRootTransactionContext(ctx, db.Begin())
 	defer func() {
 		if panicked || err != nil {
 			txCtx.Rollback()
@@ -263,3 +333,11 @@ func (m *TransactionManager) withRequiresNewPropagation(ctx context.Context, biz
 	panicked = false
 	return err
 }
+
+// transactionIfPresent manager 为空时直接执行 bizFn，否则在事务中执行
+func transactionIfPresent(ctx context.Context, manager *TransactionManager, bizFn func(txCtx context.Context) error) error {
+	if manager == nil {
+		return bizFn(ctx)
+	}
+	return manager.Transaction(ctx, bizFn)
+}
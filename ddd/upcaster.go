@@ -0,0 +1,87 @@
+package ddd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUpcasterNotFound          = errors.New("upcaster not found")
+	ErrUpcasterAlreadyRegistered = errors.New("upcaster already registered")
+)
+
+// Upcaster 把 fromVersion 版本的事件负载升级成 fromVersion+1 版本，负载格式与 EventCodec 保持一致
+type Upcaster func(payload []byte) ([]byte, error)
+
+// JSONUpcaster 以 map 的形式修改 JSON 负载，适用于 JSONEventCodec
+func JSONUpcaster(fn func(doc map[string]interface{}) error) Upcaster {
+	return func(payload []byte) ([]byte, error) {
+		doc := make(map[string]interface{})
+		if err := json.Unmarshal(payload, &doc); err != nil {
+			return nil, err
+		}
+		if err := fn(doc); err != nil {
+			return nil, err
+		}
+		return json.Marshal(doc)
+	}
+}
+
+// RegisterUpcaster 注册事件从 fromVersion 升级到 fromVersion+1 的转换，多个版本按顺序串联
+func (r *EventRegistry) RegisterUpcaster(eventType string, fromVersion int, upcaster Upcaster) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	chain, ok := r.upcasters[eventType]
+	if !ok {
+		chain = make(map[int]Upcaster)
+		r.upcasters[eventType] = chain
+	}
+	if _, ok := chain[fromVersion]; ok {
+		return fmt.Errorf("%w: %s v%d", ErrUpcasterAlreadyRegistered, eventType, fromVersion)
+	}
+	chain[fromVersion] = upcaster
+	return nil
+}
+
+// CurrentVersion 返回事件类型当前的结构版本
+func (r *EventRegistry) CurrentVersion(eventType string) (int, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if version, ok := r.versions[eventType]; ok {
+		return version, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrEventTypeNotRegistered, eventType)
+}
+
+// Upcast 把 version 版本的负载逐级升级到当前版本，返回升级后的负载和版本
+func (r *EventRegistry) Upcast(eventType string, version int, payload []byte) ([]byte, int, error) {
+	current, err := r.CurrentVersion(eventType)
+	if err != nil {
+		return nil, version, err
+	}
+	if version <= 0 {
+		version = 1
+	}
+	for version < current {
+		r.lock.RLock()
+		upcaster, ok := r.upcasters[eventType][version]
+		r.lock.RUnlock()
+		if !ok {
+			return nil, version, fmt.Errorf("%w: %s v%d", ErrUpcasterNotFound, eventType, version)
+		}
+		if payload, err = upcaster(payload); err != nil {
+			return nil, version, err
+		}
+		version++
+	}
+	return payload, version, nil
+}
+
+// RegisterEventUpcaster 在全局注册表中注册升级转换，一般在 init 中调用
+func RegisterEventUpcaster(eventType string, fromVersion int, upcaster Upcaster) {
+	if err := defaultEventRegistry.RegisterUpcaster(eventType, fromVersion, upcaster); err != nil {
+		panic(err)
+	}
+}
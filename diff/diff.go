@@ -3,32 +3,96 @@ package diff
 type AggregateDiff interface {
 	IsEmpty() bool
 	IsSelfChanged() bool
+	// SelfDiff 没有 tag 的字段的改动
+	SelfDiff() Diff
 	GetDiff(string) Diff
+	// GetListDiff map 字段同样返回 ListDiff，只包含 map 中的值，需要 key 时使用 GetMapDiff
 	GetListDiff(string) ListDiff
+	GetMapDiff(string) MapDiff
+	// DiffNames/ListDiffNames/MapDiffNames 有记录的 tag，按名称排序
+	DiffNames() []string
+	ListDiffNames() []string
+	MapDiffNames() []string
+	// Changes 所有字段级别的改动，按 Path 排序
+	Changes() []FieldChange
 }
 
 type AggregateDiffBuilder interface {
 	AggregateDiff
 	SetSelfChanged(bool) AggregateDiffBuilder
+	AppendSelfChange(FieldChange) AggregateDiffBuilder
 	PutDiff(string, Diff) AggregateDiffBuilder
+	// AppendChange 向 tag 对应的 Diff 追加一条字段改动
+	AppendChange(string, FieldChange) AggregateDiffBuilder
 	PutListDiff(string, ListDiff) AggregateDiffBuilder
+	PutMapDiff(string, MapDiff) AggregateDiffBuilder
 	Build() AggregateDiff
 }
 
+// FieldChange 单个字段的改动，Path 是从聚合根开始以 . 分隔的字段路径
+type FieldChange struct {
+	Path     string
+	OldValue interface{}
+	NewValue interface{}
+	// Hidden 字段在 json 中没有对应的路径（json:"-"），无法转换成 JSON Patch
+	Hidden bool `json:",omitempty"`
+}
+
 type Diff interface {
 	IsChanged() bool
+	// Changes 字段级别的改动，只通过 NewDiff 标记是否改动时为空
+	Changes() []FieldChange
 }
 
 type ListDiff interface {
 	Diff
+	// Path slice 字段的路径
+	Path() string
+	// FromEmpty 快照中的 slice 为 nil 或者没有元素
+	FromEmpty() bool
 	Added() []interface{}
 	Removed() []interface{}
 	Modified() []interface{}
+	// ModifiedOld 与 Modified 一一对应的修改前的值，没有记录时为空
+	ModifiedOld() []interface{}
+	// Operations 把快照中的列表变成当前列表的操作，按顺序执行
+	Operations() []ListOp
 }
 
 type ListDiffBuilder interface {
 	AppendAdded(v interface{}) ListDiffBuilder
 	AppendRemoved(v interface{}) ListDiffBuilder
 	AppendModified(v interface{}) ListDiffBuilder
+	// AppendModifiedWithOld 与 AppendModified 相同，同时记录修改前的值
+	AppendModifiedWithOld(old, new interface{}) ListDiffBuilder
+	SetPath(path string) ListDiffBuilder
+	SetFromEmpty(fromEmpty bool) ListDiffBuilder
+	SetOperations(ops []ListOp) ListDiffBuilder
 	Build() ListDiff
 }
+
+// MapEntry map 中单个 key 的改动，新增时 Old 为空，删除时 New 为空
+type MapEntry struct {
+	Key interface{}
+	Old interface{}
+	New interface{}
+}
+
+type MapDiff interface {
+	Diff
+	// Path map 字段的路径
+	Path() string
+	// FromEmpty 快照中的 map 为 nil 或者没有元素
+	FromEmpty() bool
+	Added() []MapEntry
+	Removed() []MapEntry
+	Modified() []MapEntry
+}
+
+type MapDiffBuilder interface {
+	AppendAdded(key, v interface{}) MapDiffBuilder
+	AppendRemoved(key, v interface{}) MapDiffBuilder
+	AppendModified(key, old, new interface{}) MapDiffBuilder
+	SetFromEmpty(fromEmpty bool) MapDiffBuilder
+	Build() MapDiff
+}
@@ -10,6 +10,22 @@ func (e emptyListDiff) IsChanged() bool {
 	return false
 }
 
+func (e emptyListDiff) Changes() []FieldChange {
+	return nil
+}
+
+func (e emptyListDiff) Path() string {
+	return ""
+}
+
+func (e emptyListDiff) FromEmpty() bool {
+	return false
+}
+
+func (e emptyListDiff) Operations() []ListOp {
+	return nil
+}
+
 func (e emptyListDiff) Added() []interface{} {
 	return nil
 }
@@ -22,6 +38,44 @@ func (e emptyListDiff) Modified() []interface{} {
 	return nil
 }
 
+func (e emptyListDiff) ModifiedOld() []interface{} {
+	return nil
+}
+
+func EmptyMapDiff() MapDiff {
+	return &emptyMapDiff{}
+}
+
+type emptyMapDiff struct{}
+
+func (e emptyMapDiff) IsChanged() bool {
+	return false
+}
+
+func (e emptyMapDiff) Changes() []FieldChange {
+	return nil
+}
+
+func (e emptyMapDiff) Path() string {
+	return ""
+}
+
+func (e emptyMapDiff) FromEmpty() bool {
+	return false
+}
+
+func (e emptyMapDiff) Added() []MapEntry {
+	return nil
+}
+
+func (e emptyMapDiff) Removed() []MapEntry {
+	return nil
+}
+
+func (e emptyMapDiff) Modified() []MapEntry {
+	return nil
+}
+
 func EmptyAggregateDiff() AggregateDiff {
 	return &emptyAggregateDiff{}
 }
@@ -36,6 +90,14 @@ func (e emptyAggregateDiff) IsSelfChanged() bool {
 	return false
 }
 
+func (e emptyAggregateDiff) SelfDiff() Diff {
+	return NewDiff(false)
+}
+
+func (e emptyAggregateDiff) Changes() []FieldChange {
+	return nil
+}
+
 func (e emptyAggregateDiff) GetDiff(s string) Diff {
 	return NewDiff(false)
 }
@@ -43,3 +105,19 @@ func (e emptyAggregateDiff) GetDiff(s string) Diff {
 func (e emptyAggregateDiff) GetListDiff(s string) ListDiff {
 	return EmptyListDiff()
 }
+
+func (e emptyAggregateDiff) GetMapDiff(s string) MapDiff {
+	return EmptyMapDiff()
+}
+
+func (e emptyAggregateDiff) DiffNames() []string {
+	return nil
+}
+
+func (e emptyAggregateDiff) ListDiffNames() []string {
+	return nil
+}
+
+func (e emptyAggregateDiff) MapDiffNames() []string {
+	return nil
+}
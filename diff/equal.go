@@ -0,0 +1,213 @@
+package diff
+
+import (
+	"reflect"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Equaler 类型自定义相等判断，other 与接收者类型相同
+type Equaler interface {
+	Equal(other interface{}) bool
+}
+
+// Comparer 判断同一类型的两个值是否相等
+type Comparer func(x, y interface{}) bool
+
+var (
+	comparers    = make(map[reflect.Type]Comparer)
+	comparerLock sync.RWMutex
+	equalerType  = reflect.TypeOf((*Equaler)(nil)).Elem()
+)
+
+func init() {
+	// time.Time 的单调时钟、时区不同不算改动
+	RegisterComparerFor(func(x, y time.Time) bool {
+		return x.Equal(y)
+	})
+}
+
+// RegisterComparer 为类型 t 注册比较函数，优先级高于 Equaler
+func RegisterComparer(t reflect.Type, comparer Comparer) {
+	comparerLock.Lock()
+	defer comparerLock.Unlock()
+	comparers[t] = comparer
+}
+
+// RegisterComparerFor 为 T 注册比较函数，比如允许误差的浮点数
+func RegisterComparerFor[T any](fn func(x, y T) bool) {
+	RegisterComparer(reflect.TypeOf((*T)(nil)).Elem(), func(x, y interface{}) bool {
+		return fn(x.(T), y.(T))
+	})
+}
+
+func lookupComparer(t reflect.Type) (Comparer, bool) {
+	comparerLock.RLock()
+	defer comparerLock.RUnlock()
+	comparer, ok := comparers[t]
+	return comparer, ok
+}
+
+// HasCustomEqual 类型 t 是否注册了比较函数或实现了 Equaler，这种类型应该整体比较
+func HasCustomEqual(t reflect.Type) bool {
+	if _, ok := lookupComparer(t); ok {
+		return true
+	}
+	return t.Implements(equalerType)
+}
+
+// Equal 与 reflect.DeepEqual 相同，但遇到注册了比较函数或实现了 Equaler 的类型时使用自定义的判断
+// 未导出字段同样使用自定义的判断，只有经过未导出字段取到的 map 的值、interface 中的值除外
+func Equal(x, y interface{}) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	vx := addressable(reflect.ValueOf(x))
+	vy := addressable(reflect.ValueOf(y))
+	if vx.Type() != vy.Type() {
+		return false
+	}
+	return equalValue(vx, vy, make(map[visit]bool))
+}
+
+// addressable 复制一份可寻址的结构体、数组，这样未导出的字段也可以通过 exported 取到
+func addressable(v reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Struct && v.Kind() != reflect.Array {
+		return v
+	}
+	rlt := reflect.New(v.Type()).Elem()
+	rlt.Set(v)
+	return rlt
+}
+
+// exported 未导出字段的值不能调用 Interface，可寻址时通过 unsafe 绕过这个限制，只用来读取
+func exported(v reflect.Value) (reflect.Value, bool) {
+	if v.CanInterface() {
+		return v, true
+	}
+	if v.CanAddr() {
+		return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem(), true
+	}
+	return v, false
+}
+
+// EqualComparable 可比较类型的快速判断，值不同时再使用注册的比较函数，供生成的代码使用
+func EqualComparable[T comparable](x, y T) bool {
+	if x == y {
+		return true
+	}
+	if comparer, ok := lookupComparer(reflect.TypeOf(x)); ok {
+		return comparer(x, y)
+	}
+	if equaler, ok := interface{}(x).(Equaler); ok {
+		return equaler.Equal(y)
+	}
+	return false
+}
+
+type visit struct {
+	x, y unsafe.Pointer
+	typ  reflect.Type
+}
+
+func equalValue(x, y reflect.Value, visited map[visit]bool) bool {
+	if !x.IsValid() || !y.IsValid() {
+		return x.IsValid() == y.IsValid()
+	}
+	if x.Type() != y.Type() {
+		return false
+	}
+	if ex, ok := exported(x); ok {
+		if ey, ok := exported(y); ok {
+			if comparer, ok := lookupComparer(x.Type()); ok {
+				return comparer(ex.Interface(), ey.Interface())
+			}
+			if equaler, ok := ex.Interface().(Equaler); ok && !isNilValue(x) {
+				return equaler.Equal(ey.Interface())
+			}
+		}
+	}
+
+	// 与 reflect.DeepEqual 一样记录已经比较过的引用，防止成环
+	switch x.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		if x.Kind() != reflect.Interface && !x.IsNil() && !y.IsNil() {
+			v := visit{unsafe.Pointer(x.Pointer()), unsafe.Pointer(y.Pointer()), x.Type()}
+			if visited[v] {
+				return true
+			}
+			visited[v] = true
+		}
+	}
+
+	switch x.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		return equalValue(x.Elem(), y.Elem(), visited)
+	case reflect.Array:
+		for i := 0; i < x.Len(); i++ {
+			if !equalValue(x.Index(i), y.Index(i), visited) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if x.IsNil() != y.IsNil() || x.Len() != y.Len() {
+			return false
+		}
+		for i := 0; i < x.Len(); i++ {
+			if !equalValue(x.Index(i), y.Index(i), visited) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if x.IsNil() != y.IsNil() || x.Len() != y.Len() {
+			return false
+		}
+		iter := x.MapRange()
+		for iter.Next() {
+			vy := y.MapIndex(iter.Key())
+			if !vy.IsValid() || !equalValue(iter.Value(), vy, visited) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			if !equalValue(x.Field(i), y.Field(i), visited) {
+				return false
+			}
+		}
+		return true
+	case reflect.Func:
+		// 与 reflect.DeepEqual 一致，只有都为 nil 时相等
+		return x.IsNil() && y.IsNil()
+	case reflect.Bool:
+		return x.Bool() == y.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return x.Int() == y.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return x.Uint() == y.Uint()
+	case reflect.Float32, reflect.Float64:
+		return x.Float() == y.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return x.Complex() == y.Complex()
+	case reflect.String:
+		return x.String() == y.String()
+	case reflect.Chan, reflect.UnsafePointer:
+		return x.Pointer() == y.Pointer()
+	}
+	return false
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
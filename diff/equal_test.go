@@ -0,0 +1,33 @@
+package diff
+
+import (
+	"testing"
+	"time"
+)
+
+type equalUnexported struct {
+	at    time.Time
+	inner struct {
+		at time.Time
+	}
+	ptr *time.Time
+}
+
+func TestEqualUnexportedComparer(t *testing.T) {
+	now := time.Now()
+	utc := now.UTC()
+	x := equalUnexported{at: now, ptr: &now}
+	x.inner.at = now
+	y := equalUnexported{at: utc, ptr: &utc}
+	y.inner.at = utc
+	if !Equal(x, y) {
+		t.Fatal("registered comparer should apply to unexported fields")
+	}
+	if !Equal(&x, &y) {
+		t.Fatal("registered comparer should apply to unexported fields behind a pointer")
+	}
+	y.inner.at = utc.Add(time.Second)
+	if Equal(x, y) {
+		t.Fatal("different times should not be equal")
+	}
+}
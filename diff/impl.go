@@ -1,5 +1,7 @@
 package diff
 
+import "sort"
+
 func NewDiff(isDiff bool) Diff {
 	return diff(isDiff)
 }
@@ -10,14 +12,56 @@ func (d diff) IsChanged() bool {
 	return bool(d)
 }
 
+func (d diff) Changes() []FieldChange {
+	return nil
+}
+
+// NewFieldDiff 由字段改动组成的 Diff，没有改动时 IsChanged 为 false
+func NewFieldDiff(changes ...FieldChange) Diff {
+	return &fieldDiff{changes: changes}
+}
+
+type fieldDiff struct {
+	changes []FieldChange
+}
+
+func (d *fieldDiff) IsChanged() bool {
+	return len(d.changes) > 0
+}
+
+func (d *fieldDiff) Changes() []FieldChange {
+	return d.changes
+}
+
 type listDiff struct {
-	added    []interface{}
-	removed  []interface{}
-	modified []interface{}
+	path      string
+	fromEmpty bool
+	ops       []ListOp
+	added     []interface{}
+	removed   []interface{}
+	modified  []interface{}
+	// modifiedOld 只有全部修改都通过 AppendModifiedWithOld 追加时才与 modified 一一对应
+	modifiedOld []interface{}
 }
 
 func (l *listDiff) IsChanged() bool {
-	return len(l.added) > 0 || len(l.removed) > 0 || len(l.modified) > 0
+	return len(l.added) > 0 || len(l.removed) > 0 || len(l.modified) > 0 || len(l.ops) > 0
+}
+
+func (l *listDiff) Changes() []FieldChange {
+	return nil
+}
+
+func (l *listDiff) Path() string {
+	return l.path
+}
+
+func (l *listDiff) FromEmpty() bool {
+	return l.fromEmpty
+}
+
+func (l *listDiff) Operations() []ListOp {
+	return l.ops
 }
 
 func (l *listDiff) Added() []interface{} {
@@ -32,6 +76,13 @@ func (l *listDiff) Modified() []interface{} {
 	return l.modified
 }
 
+func (l *listDiff) ModifiedOld() []interface{} {
+	if len(l.modifiedOld) != len(l.modified) {
+		return nil
+	}
+	return l.modifiedOld
+}
+
 func NewListDiffBuilder() ListDiffBuilder {
 	return &listDiffBuilder{
 		ld: &listDiff{},
@@ -57,14 +108,107 @@ func (b *listDiffBuilder) AppendModified(v interface{}) ListDiffBuilder {
 	return b
 }
 
+func (b *listDiffBuilder) AppendModifiedWithOld(old, new interface{}) ListDiffBuilder {
+	b.ld.modified = append(b.ld.modified, new)
+	b.ld.modifiedOld = append(b.ld.modifiedOld, old)
+	return b
+}
+
+func (b *listDiffBuilder) SetPath(path string) ListDiffBuilder {
+	b.ld.path = path
+	return b
+}
+
+func (b *listDiffBuilder) SetFromEmpty(fromEmpty bool) ListDiffBuilder {
+	b.ld.fromEmpty = fromEmpty
+	return b
+}
+
+func (b *listDiffBuilder) SetOperations(ops []ListOp) ListDiffBuilder {
+	b.ld.ops = ops
+	return b
+}
+
 func (b *listDiffBuilder) Build() ListDiff {
 	return b.ld
 }
 
+type mapDiff struct {
+	path      string
+	fromEmpty bool
+	added     []MapEntry
+	removed   []MapEntry
+	modified  []MapEntry
+}
+
+func (m *mapDiff) IsChanged() bool {
+	return len(m.added) > 0 || len(m.removed) > 0 || len(m.modified) > 0
+}
+
+func (m *mapDiff) Changes() []FieldChange {
+	return nil
+}
+
+func (m *mapDiff) Path() string {
+	return m.path
+}
+
+func (m *mapDiff) FromEmpty() bool {
+	return m.fromEmpty
+}
+
+func (m *mapDiff) Added() []MapEntry {
+	return m.added
+}
+
+func (m *mapDiff) Removed() []MapEntry {
+	return m.removed
+}
+
+func (m *mapDiff) Modified() []MapEntry {
+	return m.modified
+}
+
+func NewMapDiffBuilder(path string) MapDiffBuilder {
+	return &mapDiffBuilder{
+		md: &mapDiff{path: path},
+	}
+}
+
+type mapDiffBuilder struct {
+	md *mapDiff
+}
+
+func (b *mapDiffBuilder) AppendAdded(key, v interface{}) MapDiffBuilder {
+	b.md.added = append(b.md.added, MapEntry{Key: key, New: v})
+	return b
+}
+
+func (b *mapDiffBuilder) AppendRemoved(key, v interface{}) MapDiffBuilder {
+	b.md.removed = append(b.md.removed, MapEntry{Key: key, Old: v})
+	return b
+}
+
+func (b *mapDiffBuilder) AppendModified(key, old, new interface{}) MapDiffBuilder {
+	b.md.modified = append(b.md.modified, MapEntry{Key: key, Old: old, New: new})
+	return b
+}
+
+func (b *mapDiffBuilder) SetFromEmpty(fromEmpty bool) MapDiffBuilder {
+	b.md.fromEmpty = fromEmpty
+	return b
+}
+
+func (b *mapDiffBuilder) Build() MapDiff {
+	return b.md
+}
+
 type aggregateDiff struct {
 	selfChanged bool
+	selfChanges []FieldChange
 	diffMap     map[string]Diff
 	listDiffMap map[string]ListDiff
+	mapDiffMap  map[string]MapDiff
 }
 
 func (d *aggregateDiff) IsEmpty() bool {
@@ -81,6 +225,11 @@ func (d *aggregateDiff) IsEmpty() bool {
 			return false
 		}
 	}
+	for _, v := range d.mapDiffMap {
+		if v.IsChanged() {
+			return false
+		}
+	}
 	return true
 }
 
@@ -88,6 +237,24 @@ func (d *aggregateDiff) IsSelfChanged() bool {
 	return d.selfChanged
 }
 
+func (d *aggregateDiff) SelfDiff() Diff {
+	if len(d.selfChanges) == 0 {
+		return NewDiff(d.selfChanged)
+	}
+	return NewFieldDiff(d.selfChanges...)
+}
+
+func (d *aggregateDiff) Changes() []FieldChange {
+	rlt := append([]FieldChange(nil), d.selfChanges...)
+	for _, v := range d.diffMap {
+		rlt = append(rlt, v.Changes()...)
+	}
+	sort.SliceStable(rlt, func(i, j int) bool {
+		return rlt[i].Path < rlt[j].Path
+	})
+	return rlt
+}
+
 func (d *aggregateDiff) GetDiff(name string) Diff {
 	if rlt, ok := d.diffMap[name]; ok {
 		return rlt
@@ -95,18 +262,72 @@ func (d *aggregateDiff) GetDiff(name string) Diff {
 	return NewDiff(false)
 }
 
+// GetListDiff map 字段同样可以取到 ListDiff，Added/Removed/Modified 为 map 中的值，与 MapDiff 之前的行为一致
 func (d *aggregateDiff) GetListDiff(name string) ListDiff {
 	if rlt, ok := d.listDiffMap[name]; ok {
 		return rlt
 	}
+	if md, ok := d.mapDiffMap[name]; ok {
+		return mapAsListDiff(md)
+	}
 	return EmptyListDiff()
 }
 
+// mapAsListDiff 把 MapDiff 转换成只有值的 ListDiff，没有 Operations
+func mapAsListDiff(md MapDiff) ListDiff {
+	builder := NewListDiffBuilder().SetPath(md.Path()).SetFromEmpty(md.FromEmpty())
+	for _, entry := range md.Added() {
+		builder.AppendAdded(entry.New)
+	}
+	for _, entry := range md.Removed() {
+		builder.AppendRemoved(entry.Old)
+	}
+	for _, entry := range md.Modified() {
+		builder.AppendModifiedWithOld(entry.Old, entry.New)
+	}
+	return builder.Build()
+}
+
+func (d *aggregateDiff) GetMapDiff(name string) MapDiff {
+	if rlt, ok := d.mapDiffMap[name]; ok {
+		return rlt
+	}
+	return EmptyMapDiff()
+}
+
+func (d *aggregateDiff) DiffNames() []string {
+	rlt := make([]string, 0, len(d.diffMap))
+	for k := range d.diffMap {
+		rlt = append(rlt, k)
+	}
+	sort.Strings(rlt)
+	return rlt
+}
+
+func (d *aggregateDiff) ListDiffNames() []string {
+	rlt := make([]string, 0, len(d.listDiffMap))
+	for k := range d.listDiffMap {
+		rlt = append(rlt, k)
+	}
+	sort.Strings(rlt)
+	return rlt
+}
+
+func (d *aggregateDiff) MapDiffNames() []string {
+	rlt := make([]string, 0, len(d.mapDiffMap))
+	for k := range d.mapDiffMap {
+		rlt = append(rlt, k)
+	}
+	sort.Strings(rlt)
+	return rlt
+}
+
 func NewAggregateDiffBuilder() AggregateDiffBuilder {
 	return &aggregateDiffBuilder{
 		&aggregateDiff{
 			diffMap:     make(map[string]Diff),
 			listDiffMap: make(map[string]ListDiff),
+			mapDiffMap:  make(map[string]MapDiff),
 		},
 	}
 }
@@ -123,6 +344,14 @@ func (b *aggregateDiffBuilder) IsSelfChanged() bool {
 	return b.ad.IsSelfChanged()
 }
 
+func (b *aggregateDiffBuilder) SelfDiff() Diff {
+	return b.ad.SelfDiff()
+}
+
+func (b *aggregateDiffBuilder) Changes() []FieldChange {
+	return b.ad.Changes()
+}
+
 func (b *aggregateDiffBuilder) GetDiff(tag string) Diff {
 	return b.ad.GetDiff(tag)
 }
@@ -131,21 +360,57 @@ func (b *aggregateDiffBuilder) GetListDiff(tag string) ListDiff {
 	return b.ad.GetListDiff(tag)
 }
 
+func (b *aggregateDiffBuilder) GetMapDiff(tag string) MapDiff {
+	return b.ad.GetMapDiff(tag)
+}
+
+func (b *aggregateDiffBuilder) DiffNames() []string {
+	return b.ad.DiffNames()
+}
+
+func (b *aggregateDiffBuilder) ListDiffNames() []string {
+	return b.ad.ListDiffNames()
+}
+
+func (b *aggregateDiffBuilder) MapDiffNames() []string {
+	return b.ad.MapDiffNames()
+}
+
 func (b *aggregateDiffBuilder) SetSelfChanged(selfChange bool) AggregateDiffBuilder {
 	b.ad.selfChanged = selfChange
 	return b
 }
 
+func (b *aggregateDiffBuilder) AppendSelfChange(change FieldChange) AggregateDiffBuilder {
+	b.ad.selfChanged = true
+	b.ad.selfChanges = append(b.ad.selfChanges, change)
+	return b
+}
+
 func (b *aggregateDiffBuilder) PutDiff(tag string, d Diff) AggregateDiffBuilder {
 	b.ad.diffMap[tag] = d
 	return b
 }
 
+func (b *aggregateDiffBuilder) AppendChange(tag string, change FieldChange) AggregateDiffBuilder {
+	var changes []FieldChange
+	if d, ok := b.ad.diffMap[tag]; ok {
+		changes = d.Changes()
+	}
+	b.ad.diffMap[tag] = NewFieldDiff(append(changes, change)...)
+	return b
+}
+
 func (b *aggregateDiffBuilder) PutListDiff(tag string, ld ListDiff) AggregateDiffBuilder {
 	b.ad.listDiffMap[tag] = ld
 	return b
 }
 
+func (b *aggregateDiffBuilder) PutMapDiff(tag string, md MapDiff) AggregateDiffBuilder {
+	b.ad.mapDiffMap[tag] = md
+	return b
+}
+
 func (b *aggregateDiffBuilder) Build() AggregateDiff {
 	return b.ad
 }
@@ -0,0 +1,432 @@
+package diff
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/zhenyu888/ddd-core/funcs"
+)
+
+var (
+	ErrDiffNotExportable = errors.New("diff has no field level changes, can't export json patch")
+	ErrDiffPathHidden    = errors.New("diff path not present in json, can't export json patch")
+	ErrPatchPathNotFound = errors.New("json patch path not found")
+	ErrPatchInvalidOp    = errors.New("invalid json patch operation")
+)
+
+// JSONPatchOperation RFC 6902 中的单个操作
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+func (o JSONPatchOperation) MarshalJSON() ([]byte, error) {
+	rlt := map[string]interface{}{
+		"op":   o.Op,
+		"path": o.Path,
+	}
+	switch o.Op {
+	case "add", "replace", "test":
+		// value 为空时也需要输出 null
+		rlt["value"] = o.Value
+	case "move", "copy":
+		rlt["from"] = o.From
+	}
+	return json.Marshal(rlt)
+}
+
+// JSONPatch RFC 6902 JSON Patch 文档
+type JSONPatch []JSONPatchOperation
+
+// ToJSONPatch 把 AggregateDiff 转换成 JSON Patch，路径使用 json tag 中的名称
+// 只知道是否改动、没有字段级别改动的 Diff 无法转换，返回 ErrDiffNotExportable
+// 改动了 json 中不存在的字段时返回 ErrDiffPathHidden
+func ToJSONPatch(d AggregateDiff) (JSONPatch, error) {
+	if err := checkExportable(d); err != nil {
+		return nil, err
+	}
+	if err := checkAddressable(d.Changes()); err != nil {
+		return nil, err
+	}
+	var rlt JSONPatch
+	rlt = append(rlt, changesPatch(d.Changes())...)
+	for _, name := range d.ListDiffNames() {
+		rlt = append(rlt, listPatch(d.GetListDiff(name))...)
+	}
+	for _, name := range d.MapDiffNames() {
+		rlt = append(rlt, mapPatch(d.GetMapDiff(name))...)
+	}
+	return rlt, nil
+}
+
+func checkExportable(d AggregateDiff) error {
+	if d.IsSelfChanged() && len(d.SelfDiff().Changes()) == 0 {
+		return ErrDiffNotExportable
+	}
+	for _, name := range d.DiffNames() {
+		if sub := d.GetDiff(name); sub.IsChanged() && len(sub.Changes()) == 0 {
+			return ErrDiffNotExportable
+		}
+	}
+	return nil
+}
+
+// checkAddressable 改动了 json 中不存在的字段时无法转换成 JSON Patch
+func checkAddressable(changes []FieldChange) error {
+	for _, change := range changes {
+		if change.Hidden {
+			return fmt.Errorf("%w: %s", ErrDiffPathHidden, change.Path)
+		}
+	}
+	return nil
+}
+
+// changesPatch 旧值为空时字段可能因为 omitempty 不在 json 中，使用 add，成员已经存在时 add 同样会替换
+func changesPatch(changes []FieldChange) JSONPatch {
+	var rlt JSONPatch
+	for _, change := range changes {
+		op := "replace"
+		if isEmptyJSONValue(change.OldValue) {
+			op = "add"
+		}
+		rlt = append(rlt, JSONPatchOperation{Op: op, Path: toJSONPointer(strings.Split(change.Path, ".")...), Value: change.NewValue})
+	}
+	return rlt
+}
+
+// isEmptyJSONValue 与 encoding/json 中 omitempty 判断空值的规则相同
+func isEmptyJSONValue(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// listPatch 快照中的 slice 为空时可能是 null 或者因为 omitempty 不存在，整体 add
+func listPatch(ld ListDiff) JSONPatch {
+	if ld.FromEmpty() && len(ld.Operations()) > 0 {
+		return JSONPatch{{Op: "add", Path: toJSONPointer(ld.Path()), Value: ApplyOperations(nil, ld.Operations())}}
+	}
+	var rlt JSONPatch
+	for _, op := range ld.Operations() {
+		path := toJSONPointer(ld.Path(), strconv.Itoa(op.Index))
+		switch op.Type {
+		case ListOpInsert:
+			rlt = append(rlt, JSONPatchOperation{Op: "add", Path: path, Value: op.Value})
+		case ListOpDelete:
+			rlt = append(rlt, JSONPatchOperation{Op: "remove", Path: path})
+		case ListOpMove:
+			rlt = append(rlt, JSONPatchOperation{Op: "move", Path: path, From: toJSONPointer(ld.Path(), strconv.Itoa(op.From))})
+		case ListOpReplace:
+			rlt = append(rlt, JSONPatchOperation{Op: "replace", Path: path, Value: op.Value})
+		}
+	}
+	return rlt
+}
+
+// mapPatch 快照中的 map 为空时与 slice 一样整体 add
+func mapPatch(md MapDiff) JSONPatch {
+	if md.FromEmpty() && len(md.Added()) > 0 {
+		value := make(map[string]interface{}, len(md.Added()))
+		for _, entry := range md.Added() {
+			value[fmt.Sprint(entry.Key)] = entry.New
+		}
+		return JSONPatch{{Op: "add", Path: toJSONPointer(md.Path()), Value: value}}
+	}
+	var rlt JSONPatch
+	for _, entry := range md.Removed() {
+		rlt = append(rlt, JSONPatchOperation{Op: "remove", Path: toJSONPointer(md.Path(), fmt.Sprint(entry.Key))})
+	}
+	for _, entry := range md.Added() {
+		rlt = append(rlt, JSONPatchOperation{Op: "add", Path: toJSONPointer(md.Path(), fmt.Sprint(entry.Key)), Value: entry.New})
+	}
+	for _, entry := range md.Modified() {
+		rlt = append(rlt, JSONPatchOperation{Op: "replace", Path: toJSONPointer(md.Path(), fmt.Sprint(entry.Key)), Value: entry.New})
+	}
+	return rlt
+}
+
+func toJSONPointer(tokens ...string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteByte('/')
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return b.String()
+}
+
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: bad path %q", ErrPatchInvalidOp, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// ApplyJSONPatch 把 patch 应用到 target 的副本上并返回副本，target 本身不会被修改
+// 副本由 funcs.DeepCopyOf 复制后通过 json 编解码更新，json:"-" 的字段保持 target 中的值
+func ApplyJSONPatch[T any](target T, patch JSONPatch) (T, error) {
+	var zero T
+	data, err := json.Marshal(target)
+	if err != nil {
+		return zero, err
+	}
+	var doc interface{}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return zero, err
+	}
+	for _, op := range patch {
+		if doc, err = applyOperation(doc, op); err != nil {
+			return zero, err
+		}
+	}
+	if data, err = json.Marshal(doc); err != nil {
+		return zero, err
+	}
+
+	copied := funcs.DeepCopyOf(target)
+	// 先清空会被 json 覆盖的字段，避免 map 合并、被删除的字段残留
+	resetJSONFields(reflect.ValueOf(&copied).Elem())
+	if err = json.Unmarshal(data, &copied); err != nil {
+		return zero, err
+	}
+	return copied, nil
+}
+
+func resetJSONFields(v reflect.Value) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		if v.CanSet() {
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" {
+			// 没有 json tag 的内嵌字段会被展开
+			resetJSONFields(v.Field(i))
+			continue
+		}
+		if field.PkgPath != "" || !v.Field(i).CanSet() {
+			continue
+		}
+		v.Field(i).Set(reflect.Zero(field.Type))
+	}
+}
+
+func applyOperation(doc interface{}, op JSONPatchOperation) (interface{}, error) {
+	tokens, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		return setValue(doc, tokens, normalizeValue(op.Value), true)
+	case "replace":
+		return setValue(doc, tokens, normalizeValue(op.Value), false)
+	case "remove":
+		doc, _, err = removeValue(doc, tokens)
+		return doc, err
+	case "move", "copy":
+		fromTokens, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		if op.Op == "move" {
+			doc, v, err = removeValue(doc, fromTokens)
+		} else {
+			v, err = getValue(doc, fromTokens)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return setValue(doc, tokens, v, true)
+	case "test":
+		v, err := getValue(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(v, normalizeValue(op.Value)) {
+			return nil, fmt.Errorf("%w: test failed at %q", ErrPatchInvalidOp, op.Path)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrPatchInvalidOp, op.Op)
+}
+
+// normalizeValue 把 go 值转换成 json 解码后的形式，方便和文档中的值比较、合并
+func normalizeValue(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var rlt interface{}
+	if err = json.Unmarshal(data, &rlt); err != nil {
+		return v
+	}
+	return rlt
+}
+
+func getValue(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", ErrPatchPathNotFound, token)
+			}
+			doc = v
+		case []interface{}:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("%w: %q", ErrPatchPathNotFound, token)
+			}
+			doc = node[idx]
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrPatchPathNotFound, token)
+		}
+	}
+	return doc, nil
+}
+
+// setValue insert 为 true 时对应 add：在数组中插入，对象中不存在的成员会被添加；
+// 否则对应 replace：目标必须已经存在。add 的容器为 null 时对应 go 中的 nil map/slice，
+// token 为 - 时创建数组，否则创建对象，数字 token 同样按 map 的 key 处理
+func setValue(doc interface{}, tokens []string, v interface{}, insert bool) (interface{}, error) {
+	if len(tokens) == 0 {
+		return v, nil
+	}
+	token := tokens[0]
+	if doc == nil && insert && len(tokens) == 1 {
+		if token == "-" {
+			doc = []interface{}{}
+		} else {
+			doc = map[string]interface{}{}
+		}
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if len(tokens) == 1 {
+			if _, ok := node[token]; !ok && !insert {
+				return nil, fmt.Errorf("%w: %q", ErrPatchPathNotFound, token)
+			}
+			node[token] = v
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrPatchPathNotFound, token)
+		}
+		child, err := setValue(child, tokens[1:], v, insert)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []interface{}:
+		idx := len(node)
+		if token != "-" {
+			var err error
+			if idx, err = strconv.Atoi(token); err != nil || idx < 0 || idx > len(node) {
+				return nil, fmt.Errorf("%w: %q", ErrPatchPathNotFound, token)
+			}
+		}
+		if len(tokens) == 1 {
+			if insert {
+				return append(node[:idx], append([]interface{}{v}, node[idx:]...)...), nil
+			}
+			if idx == len(node) {
+				return nil, fmt.Errorf("%w: %q", ErrPatchPathNotFound, token)
+			}
+			node[idx] = v
+			return node, nil
+		}
+		if idx == len(node) {
+			return nil, fmt.Errorf("%w: %q", ErrPatchPathNotFound, token)
+		}
+		child, err := setValue(node[idx], tokens[1:], v, insert)
+		if err != nil {
+			return nil, err
+		}
+		node[idx] = child
+		return node, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrPatchPathNotFound, token)
+}
+
+func removeValue(doc interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+	token := tokens[0]
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %q", ErrPatchPathNotFound, token)
+		}
+		if len(tokens) == 1 {
+			delete(node, token)
+			return node, child, nil
+		}
+		child, removed, err := removeValue(child, tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		node[token] = child
+		return node, removed, nil
+	case []interface{}:
+		idx, err := strconv.Atoi(token)
+		if err != nil || idx < 0 || idx >= len(node) {
+			return nil, nil, fmt.Errorf("%w: %q", ErrPatchPathNotFound, token)
+		}
+		if len(tokens) == 1 {
+			removed := node[idx]
+			return append(node[:idx], node[idx+1:]...), removed, nil
+		}
+		child, removed, err := removeValue(node[idx], tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		node[idx] = child
+		return node, removed, nil
+	}
+	return nil, nil, fmt.Errorf("%w: %q", ErrPatchPathNotFound, token)
+}
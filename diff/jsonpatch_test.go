@@ -0,0 +1,109 @@
+package diff_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/zhenyu888/ddd-core/ddd"
+	"github.com/zhenyu888/ddd-core/diff"
+)
+
+type patchItem struct {
+	Id    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+type patchAggregate struct {
+	Id      int64             `json:"id"`
+	Name    string            `json:"name,omitempty"`
+	Count   int               `json:"count"`
+	Address *patchItem        `json:"address,omitempty" trace:"address,deep"`
+	Tags    []string          `json:"tags,omitempty" trace:"tags"`
+	Items   []patchItem       `json:"items" trace:"items,key=id"`
+	Labels  map[int]string    `json:"labels" trace:"labels"`
+	Attrs   map[string]string `json:"attrs,omitempty" trace:"attrs"`
+}
+
+func (a *patchAggregate) AggregateId() int64 {
+	return a.Id
+}
+
+// assertRoundTrip diff → ToJSONPatch → ApplyJSONPatch(base) 应该得到 current
+func assertRoundTrip(t *testing.T, base, current *patchAggregate) {
+	t.Helper()
+	patch, err := diff.ToJSONPatch(ddd.Trace(current, base))
+	if err != nil {
+		t.Fatalf("ToJSONPatch: %v", err)
+	}
+	applied, err := diff.ApplyJSONPatch(base, patch)
+	if err != nil {
+		data, _ := json.Marshal(patch)
+		t.Fatalf("ApplyJSONPatch: %v, patch %s", err, data)
+	}
+	want, _ := json.Marshal(current)
+	got, _ := json.Marshal(applied)
+	if string(want) != string(got) {
+		data, _ := json.Marshal(patch)
+		t.Fatalf("round trip mismatch\nwant %s\ngot  %s\npatch %s", want, got, data)
+	}
+}
+
+func TestJSONPatchRoundTrip(t *testing.T) {
+	full := func() *patchAggregate {
+		return &patchAggregate{
+			Id:      1,
+			Name:    "name",
+			Count:   3,
+			Address: &patchItem{Id: 1, Title: "home"},
+			Tags:    []string{"a", "b", "c"},
+			Items:   []patchItem{{Id: 1, Title: "x"}, {Id: 2, Title: "y"}, {Id: 3, Title: "z"}},
+			Labels:  map[int]string{1: "a", 2: "b"},
+			Attrs:   map[string]string{"k": "v"},
+		}
+	}
+	cases := []struct {
+		name   string
+		base   *patchAggregate
+		modify func(a *patchAggregate)
+	}{
+		{"omitempty field from zero", &patchAggregate{Id: 1}, func(a *patchAggregate) { a.Name = "x" }},
+		{"nil omitempty slice", &patchAggregate{Id: 1}, func(a *patchAggregate) { a.Tags = []string{"a"} }},
+		{"nil slice", &patchAggregate{Id: 1}, func(a *patchAggregate) { a.Items = []patchItem{{Id: 1}} }},
+		{"nil map with numeric keys", &patchAggregate{Id: 1}, func(a *patchAggregate) { a.Labels = map[int]string{1: "a"} }},
+		{"nil omitempty map", &patchAggregate{Id: 1}, func(a *patchAggregate) { a.Attrs = map[string]string{"k": "v"} }},
+		{"nil pointer", &patchAggregate{Id: 1}, func(a *patchAggregate) { a.Address = &patchItem{Id: 2} }},
+		{"field to zero", full(), func(a *patchAggregate) { a.Name, a.Count = "", 0 }},
+		{"deep field", full(), func(a *patchAggregate) { a.Address.Title = "office" }},
+		{"list edits", full(), func(a *patchAggregate) {
+			a.Tags = []string{"c", "a", "d"}
+			a.Items = []patchItem{{Id: 3, Title: "z"}, {Id: 1, Title: "changed"}, {Id: 4, Title: "new"}}
+		}},
+		{"map edits", full(), func(a *patchAggregate) {
+			a.Labels = map[int]string{2: "changed", 3: "c"}
+			a.Attrs = map[string]string{}
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			current, _ := json.Marshal(c.base)
+			cur := &patchAggregate{}
+			_ = json.Unmarshal(current, cur)
+			c.modify(cur)
+			assertRoundTrip(t, c.base, cur)
+		})
+	}
+}
+
+func TestApplyJSONPatchStrict(t *testing.T) {
+	base := &patchAggregate{Id: 1, Labels: map[int]string{1: "a"}}
+	for _, op := range []diff.JSONPatchOperation{
+		{Op: "replace", Path: "/missing", Value: "x"},
+		{Op: "remove", Path: "/labels/2"},
+		{Op: "replace", Path: "/labels/2", Value: "b"},
+	} {
+		if _, err := diff.ApplyJSONPatch(base, diff.JSONPatch{op}); !errors.Is(err, diff.ErrPatchPathNotFound) {
+			t.Fatalf("%s %s: err = %v, want ErrPatchPathNotFound", op.Op, op.Path, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package diff
+
+import (
+	"sort"
+)
+
+// Tracer 计算 current 相对 snapshot 的改动，ddd.Trace 即为聚合根的 Tracer
+type Tracer func(current, snapshot interface{}) AggregateDiff
+
+// Conflict 双方都改动了同一组字段且改动不同，Group 为 trace tag，没有 tag 的字段为空
+// Hidden 为 true 时这组改动包含 json 中不存在的字段，无法用 JSON Patch 表示和合并，对应的 Patch 为空
+type Conflict struct {
+	Group  string
+	Ours   JSONPatch
+	Theirs JSONPatch
+	Hidden bool
+}
+
+// Merge 三路合并：以 ours 为基础，应用 theirs 相对 base 的改动
+// 改动按 trace tag 分组，只有一方改动或双方改动相同的组直接合并；
+// 双方改动不同的组保留 ours 的值，并在 conflicts 中返回，调用方决定是否接受合并结果
+// theirs 改动了 json 中不存在的字段（json:"-"）时整组无法合并，同样保留 ours 的值并作为冲突返回
+func Merge[T any](base, ours, theirs T, tracer Tracer) (merged T, conflicts []Conflict, err error) {
+	oursGroups, oursHidden, err := groupPatches(tracer(ours, base))
+	if err != nil {
+		return merged, nil, err
+	}
+	theirsGroups, theirsHidden, err := groupPatches(tracer(theirs, base))
+	if err != nil {
+		return merged, nil, err
+	}
+
+	var patch JSONPatch
+	for _, group := range sortedGroups(theirsGroups, theirsHidden) {
+		theirsPatch := theirsGroups[group]
+		oursPatch, changed := oursGroups[group]
+		switch {
+		case theirsHidden[group] || oursHidden[group]:
+			conflicts = append(conflicts, Conflict{Group: group, Ours: oursPatch, Theirs: theirsPatch, Hidden: true})
+		case !changed:
+			patch = append(patch, theirsPatch...)
+		case !Equal(normalizeValue(oursPatch), normalizeValue(theirsPatch)):
+			conflicts = append(conflicts, Conflict{Group: group, Ours: oursPatch, Theirs: theirsPatch})
+		}
+	}
+	if len(patch) == 0 {
+		return ours, conflicts, nil
+	}
+	if merged, err = ApplyJSONPatch(ours, patch); err != nil {
+		return merged, nil, err
+	}
+	return merged, conflicts, nil
+}
+
+// groupPatches 按 trace tag 把改动转换成 JSON Patch，只包含有改动的组
+// 包含 json 中不存在的字段的组无法转换，记录在 hidden 中
+func groupPatches(d AggregateDiff) (map[string]JSONPatch, map[string]bool, error) {
+	if err := checkExportable(d); err != nil {
+		return nil, nil, err
+	}
+	rlt := make(map[string]JSONPatch)
+	hidden := make(map[string]bool)
+	add := func(group string, patch JSONPatch) {
+		if len(patch) > 0 {
+			rlt[group] = append(rlt[group], patch...)
+		}
+	}
+	for _, name := range append([]string{""}, d.DiffNames()...) {
+		sub := d.SelfDiff()
+		if name != "" {
+			sub = d.GetDiff(name)
+		}
+		if checkAddressable(sub.Changes()) != nil {
+			hidden[name] = true
+			continue
+		}
+		add(name, changesPatch(sub.Changes()))
+	}
+	for _, name := range d.ListDiffNames() {
+		add(name, listPatch(d.GetListDiff(name)))
+	}
+	for _, name := range d.MapDiffNames() {
+		add(name, mapPatch(d.GetMapDiff(name)))
+	}
+	// 同一组的 slice/map 能转换也不单独合并，整组视为无法合并
+	for name := range hidden {
+		delete(rlt, name)
+	}
+	return rlt, hidden, nil
+}
+
+func sortedGroups(groups map[string]JSONPatch, hidden map[string]bool) []string {
+	rlt := make([]string, 0, len(groups)+len(hidden))
+	for group := range groups {
+		rlt = append(rlt, group)
+	}
+	for group := range hidden {
+		rlt = append(rlt, group)
+	}
+	sort.Strings(rlt)
+	return rlt
+}
@@ -0,0 +1,242 @@
+package diff
+
+type ListOpType int8
+
+const (
+	ListOpInsert  ListOpType = iota // 在 Index 处插入 Value
+	ListOpDelete                    // 删除 Index 处的元素
+	ListOpMove                      // 把 From 处的元素移动到 Index
+	ListOpReplace                   // 把 Index 处的元素替换为 Value
+)
+
+func (t ListOpType) String() string {
+	switch t {
+	case ListOpInsert:
+		return "insert"
+	case ListOpDelete:
+		return "delete"
+	case ListOpMove:
+		return "move"
+	case ListOpReplace:
+		return "replace"
+	}
+	return "unknown"
+}
+
+// ListOp 列表的单个操作，Index/From 都是按顺序执行到这个操作时列表中的下标
+type ListOp struct {
+	Type  ListOpType
+	Index int
+	From  int
+	Value interface{}
+}
+
+// maxSequenceCells 去掉相同的前缀和后缀后，剩余部分 len(old)*len(new) 超过该值时不再计算公共子序列
+const maxSequenceCells = 1 << 22
+
+// SequenceOperations 基于最长公共子序列计算把 old 变成 new 的操作，按顺序执行即可得到 new
+// same 判断两个元素是否是同一个元素，equal 判断同一个元素的内容是否相同，不同时生成 replace 操作
+// 去掉相同的前缀和后缀后剩余部分过大时，剩余部分退化为删除全部旧元素、插入全部新元素
+func SequenceOperations(old, new []interface{}, same, equal func(x, y interface{}) bool) []ListOp {
+	if equal == nil {
+		equal = same
+	}
+	return sequenceOperations(old, new, func(i, j int) bool {
+		return same(old[i], new[j])
+	}, equal)
+}
+
+// SequenceOperationsByKey 与 SequenceOperations 相同，oldKeys/newKeys 为每个元素的标识，标识相同视为同一个元素
+func SequenceOperationsByKey(old, new, oldKeys, newKeys []interface{}, equal func(x, y interface{}) bool) []ListOp {
+	return sequenceOperations(old, new, func(i, j int) bool {
+		return oldKeys[i] == newKeys[j]
+	}, equal)
+}
+
+func sequenceOperations(old, new []interface{}, same func(i, j int) bool, equal func(x, y interface{}) bool) []ListOp {
+	// oldToNew[i] 为 old[i] 在 new 中对应的下标，没有对应时为 -1；moved 标记不在公共子序列中的对应
+	oldToNew, newToOld, moved := matchSequence(len(old), len(new), same)
+
+	var ops []ListOp
+	// 1. 从后往前删除没有对应的元素，删除不影响前面元素的下标
+	for i := len(old) - 1; i >= 0; i-- {
+		if oldToNew[i] < 0 {
+			ops = append(ops, ListOp{Type: ListOpDelete, Index: i, Value: old[i]})
+		}
+	}
+	// current 为当前列表中元素在 old 中的下标
+	current := make([]int, 0, len(old))
+	for i := range old {
+		if oldToNew[i] >= 0 {
+			current = append(current, i)
+		}
+	}
+	// 2. 按在 new 中的顺序移动元素，每个元素放到 new 中前一个元素的后面
+	prev := -1
+	for j := range new {
+		i := newToOld[j]
+		if i < 0 {
+			continue
+		}
+		if moved[i] {
+			from := indexOf(current, i)
+			current = append(current[:from], current[from+1:]...)
+			to := 0
+			if prev >= 0 {
+				to = indexOf(current, prev) + 1
+			}
+			current = append(current[:to], append([]int{i}, current[to:]...)...)
+			ops = append(ops, ListOp{Type: ListOpMove, Index: to, From: from, Value: new[j]})
+		}
+		prev = i
+	}
+	// 3. 按顺序插入新的元素，此时列表中已有的元素和 new 中的顺序一致
+	for j := range new {
+		if newToOld[j] < 0 {
+			ops = append(ops, ListOp{Type: ListOpInsert, Index: j, Value: new[j]})
+		}
+	}
+	// 4. 替换内容改变的元素
+	for j := range new {
+		if i := newToOld[j]; i >= 0 && !equal(old[i], new[j]) {
+			ops = append(ops, ListOp{Type: ListOpReplace, Index: j, Value: new[j]})
+		}
+	}
+	return ops
+}
+
+// matchSequence 先用最长公共子序列对应元素，剩下的元素按顺序两两对应作为移动
+func matchSequence(n, m int, same func(i, j int) bool) (oldToNew, newToOld []int, moved []bool) {
+	oldToNew = make([]int, n)
+	newToOld = make([]int, m)
+	moved = make([]bool, n)
+	for i := range oldToNew {
+		oldToNew[i] = -1
+	}
+	for j := range newToOld {
+		newToOld[j] = -1
+	}
+	match := func(i, j int) {
+		oldToNew[i], newToOld[j] = j, i
+	}
+
+	// 相同的前缀和后缀直接对应，通常只有中间一小段需要计算
+	prefix := 0
+	for prefix < n && prefix < m && same(prefix, prefix) {
+		match(prefix, prefix)
+		prefix++
+	}
+	suffix := 0
+	for suffix < n-prefix && suffix < m-prefix && same(n-1-suffix, m-1-suffix) {
+		match(n-1-suffix, m-1-suffix)
+		suffix++
+	}
+	if (n-prefix-suffix)*(m-prefix-suffix) > maxSequenceCells {
+		return oldToNew, newToOld, moved
+	}
+	lcsMatch(prefix, n-suffix, prefix, m-suffix, same, match)
+
+	for j := 0; j < m; j++ {
+		if newToOld[j] >= 0 {
+			continue
+		}
+		for i := 0; i < n; i++ {
+			if oldToNew[i] < 0 && same(i, j) {
+				oldToNew[i], newToOld[j], moved[i] = j, i, true
+				break
+			}
+		}
+	}
+	return oldToNew, newToOld, moved
+}
+
+// lcsMatch 用 Hirschberg 算法求 old[i0:i1] 和 new[j0:j1] 的最长公共子序列，只占用线性的内存
+func lcsMatch(i0, i1, j0, j1 int, same func(i, j int) bool, match func(i, j int)) {
+	if i0 >= i1 || j0 >= j1 {
+		return
+	}
+	if i1-i0 == 1 {
+		for j := j0; j < j1; j++ {
+			if same(i0, j) {
+				match(i0, j)
+				return
+			}
+		}
+		return
+	}
+	mid := (i0 + i1) / 2
+	// forward[k] 为 old[i0:mid] 和 new[j0:j0+k] 的长度，backward[k] 为 old[mid:i1] 和 new[j0+k:j1] 的长度
+	forward := lcsLengths(i0, mid, j0, j1, same, false)
+	backward := lcsLengths(mid, i1, j0, j1, same, true)
+	split, best := 0, -1
+	for k := 0; k <= j1-j0; k++ {
+		if l := forward[k] + backward[k]; l > best {
+			split, best = k, l
+		}
+	}
+	lcsMatch(i0, mid, j0, j0+split, same, match)
+	lcsMatch(mid, i1, j0+split, j1, same, match)
+}
+
+// lcsLengths 逐行计算最长公共子序列长度，只保留最后一行
+// reverse 为 false 时 rlt[k] 对应 new[j0:j0+k]，为 true 时对应 new[j0+k:j1]
+func lcsLengths(i0, i1, j0, j1 int, same func(i, j int) bool, reverse bool) []int {
+	m := j1 - j0
+	prev := make([]int, m+1)
+	cur := make([]int, m+1)
+	for r := 0; r < i1-i0; r++ {
+		i := i0 + r
+		if reverse {
+			i = i1 - 1 - r
+		}
+		for c := 1; c <= m; c++ {
+			j := j0 + c - 1
+			if reverse {
+				j = j1 - c
+			}
+			if same(i, j) {
+				cur[c] = prev[c-1] + 1
+			} else if prev[c] >= cur[c-1] {
+				cur[c] = prev[c]
+			} else {
+				cur[c] = cur[c-1]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	if reverse {
+		for l, r := 0, m; l < r; l, r = l+1, r-1 {
+			prev[l], prev[r] = prev[r], prev[l]
+		}
+	}
+	return prev
+}
+
+func indexOf(s []int, v int) int {
+	for i, x := range s {
+		if x == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// ApplyOperations 按顺序执行操作，返回新的列表
+func ApplyOperations(list []interface{}, ops []ListOp) []interface{} {
+	rlt := append([]interface{}(nil), list...)
+	for _, op := range ops {
+		switch op.Type {
+		case ListOpInsert:
+			rlt = append(rlt[:op.Index], append([]interface{}{op.Value}, rlt[op.Index:]...)...)
+		case ListOpDelete:
+			rlt = append(rlt[:op.Index], rlt[op.Index+1:]...)
+		case ListOpMove:
+			v := rlt[op.From]
+			rlt = append(rlt[:op.From], rlt[op.From+1:]...)
+			rlt = append(rlt[:op.Index], append([]interface{}{v}, rlt[op.Index:]...)...)
+		case ListOpReplace:
+			rlt[op.Index] = op.Value
+		}
+	}
+	return rlt
+}
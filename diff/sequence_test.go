@@ -0,0 +1,86 @@
+package diff
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// lcsLength 完整矩阵的最长公共子序列长度，用来校验 matchSequence
+func lcsLength(old, new []interface{}) int {
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs[0][0]
+}
+
+func randomList(r *rand.Rand, n, alphabet int) []interface{} {
+	rlt := make([]interface{}, n)
+	for i := range rlt {
+		rlt[i] = r.Intn(alphabet)
+	}
+	return rlt
+}
+
+func TestSequenceOperations(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	same := func(x, y interface{}) bool { return x == y }
+	for round := 0; round < 500; round++ {
+		old := randomList(r, r.Intn(20), 6)
+		new := randomList(r, r.Intn(20), 6)
+		ops := SequenceOperations(old, new, same, nil)
+		if got := ApplyOperations(old, ops); len(got) != len(new) || (len(got) > 0 && !reflect.DeepEqual(got, new)) {
+			t.Fatalf("apply %v to %v = %v, want %v", ops, old, got, new)
+		}
+		oldToNew, _, moved := matchSequence(len(old), len(new), func(i, j int) bool { return old[i] == new[j] })
+		common := 0
+		for i := range oldToNew {
+			if oldToNew[i] >= 0 && !moved[i] {
+				common++
+			}
+		}
+		if want := lcsLength(old, new); common != want {
+			t.Fatalf("%v -> %v kept %d elements in place, want %d", old, new, common, want)
+		}
+	}
+}
+
+func TestSequenceOperationsLargeList(t *testing.T) {
+	same := func(x, y interface{}) bool { return x == y }
+	old := make([]interface{}, 50000)
+	for i := range old {
+		old[i] = i
+	}
+	// 只有中间一段不同时只对比这一段
+	new := append([]interface{}{}, old[:25000]...)
+	new = append(new, -1)
+	new = append(new, old[25000:]...)
+	new[25010], new[25011] = new[25011], new[25010]
+	ops := SequenceOperations(old, new, same, nil)
+	if len(ops) != 2 {
+		t.Fatalf("got %d ops, want one insert and one move", len(ops))
+	}
+	if got := ApplyOperations(old, ops); !reflect.DeepEqual(got, new) {
+		t.Fatal("apply mismatch")
+	}
+
+	// 整体打乱时超过上限，退化为删除和插入
+	r := rand.New(rand.NewSource(1))
+	new = append([]interface{}{}, old...)
+	r.Shuffle(len(new), func(i, j int) { new[i], new[j] = new[j], new[i] })
+	if got := ApplyOperations(old, SequenceOperations(old, new, same, nil)); !reflect.DeepEqual(got, new) {
+		t.Fatal("apply mismatch")
+	}
+}
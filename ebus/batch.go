@@ -0,0 +1,131 @@
+package ebus
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BatchEventHandler 批量事件处理器，事件按订阅者聚合后一次性回调
+type BatchEventHandler interface {
+	Identifier() string
+	OnEvents(ctx context.Context, events []interface{})
+}
+
+// BatchPolicy 批量触发条件，满足任意一个即触发 OnEvents
+type BatchPolicy struct {
+	// Size 累积到多少个事件触发一次
+	Size int
+	// Interval 距离上一批最多等待多久触发一次
+	Interval time.Duration
+}
+
+const (
+	defaultBatchSize     = 100
+	defaultBatchInterval = time.Second
+)
+
+func (p BatchPolicy) normalize() BatchPolicy {
+	if p.Size <= 0 {
+		p.Size = defaultBatchSize
+	}
+	if p.Interval <= 0 {
+		p.Interval = defaultBatchInterval
+	}
+	return p
+}
+
+type batchSubscriber struct {
+	identifier string
+	handler    BatchEventHandler
+	policy     BatchPolicy
+	events     chan interface{}
+	closing    chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+	closed     bool
+	lock       sync.RWMutex
+}
+
+func newBatchSubscriber(handler BatchEventHandler, policy BatchPolicy) *batchSubscriber {
+	policy = policy.normalize()
+	s := &batchSubscriber{
+		identifier: subscriberIdentifier(handler),
+		handler:    handler,
+		policy:     policy,
+		events:     make(chan interface{}, policy.Size),
+		closing:    make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+func (s *batchSubscriber) Identifier() string {
+	return s.identifier
+}
+
+func (s *batchSubscriber) Filter(event interface{}) bool {
+	return filterEvent(s.handler, nil, event)
+}
+
+// Dispatch 缓冲已满时阻塞，直到 loop 取走事件；Close 开始后阻塞中的事件直接丢弃
+func (s *batchSubscriber) Dispatch(ctx context.Context, event interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- event:
+	case <-s.closing:
+	}
+}
+
+// Close 停止接收事件，并把缓冲中剩余的事件全部交给 OnEvents 后返回
+func (s *batchSubscriber) Close() {
+	// 先唤醒阻塞在发送上的 Dispatch，否则它们持有读锁，Close 拿不到写锁
+	s.closeOnce.Do(func() {
+		close(s.closing)
+	})
+	s.lock.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.lock.Unlock()
+	<-s.done
+}
+
+func (s *batchSubscriber) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.policy.Interval)
+	defer ticker.Stop()
+
+	buffer := make([]interface{}, 0, s.policy.Size)
+	flush := func() {
+		if len(buffer) == 0 {
+			return
+		}
+		batch := buffer
+		buffer = make([]interface{}, 0, s.policy.Size)
+		ctx, cancel := asyncContext(context.Background(), s.handler)
+		defer cancel()
+		s.handler.OnEvents(ctx, batch)
+	}
+	for {
+		select {
+		case event, ok := <-s.events:
+			if !ok {
+				flush()
+				return
+			}
+			buffer = append(buffer, event)
+			if len(buffer) >= s.policy.Size {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package ebus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type blockingBatchHandler struct {
+	registry *SubscriberRegistry
+	entered  chan struct{}
+	release  chan struct{}
+	batches  chan []interface{}
+}
+
+func (h *blockingBatchHandler) Identifier() string {
+	return "batch"
+}
+
+func (h *blockingBatchHandler) OnEvents(ctx context.Context, events []interface{}) {
+	select {
+	case h.entered <- struct{}{}:
+		<-h.release
+	default:
+	}
+	// 处理过程中访问注册表，关闭订阅者时不能持有注册表的锁
+	h.registry.GetSubscribers(events[0])
+	h.batches <- events
+}
+
+func TestBatchSubscriberUnregisterWhileDispatchBlocked(t *testing.T) {
+	registry := NewSubscriberRegistry()
+	handler := &blockingBatchHandler{
+		registry: registry,
+		entered:  make(chan struct{}),
+		release:  make(chan struct{}),
+		batches:  make(chan []interface{}, 3),
+	}
+	if err := registry.RegisterBatch(handler, BatchPolicy{Size: 1, Interval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	sub, _ := registry.GetSubscriber(subscriberIdentifier(handler))
+	ctx := context.Background()
+	sub.Dispatch(ctx, 1)
+	<-handler.entered
+	// 缓冲已满，第三个事件阻塞在发送上
+	sub.Dispatch(ctx, 2)
+	go sub.Dispatch(ctx, 3)
+	time.Sleep(10 * time.Millisecond)
+
+	unregistered := make(chan struct{})
+	go func() {
+		registry.Unregister(handler)
+		close(unregistered)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(handler.release)
+	select {
+	case <-unregistered:
+	case <-time.After(time.Second):
+		t.Fatal("Unregister deadlocked")
+	}
+	if got := len(handler.batches); got < 2 {
+		t.Fatalf("flushed %d batches, want the buffered events to be handled", got)
+	}
+}
@@ -0,0 +1,35 @@
+package ebus
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Codec 事件编解码，持久化分发器用它把事件写入本地日志
+type Codec interface {
+	Encode(event interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+type gobCodec struct{}
+
+// NewGobCodec 基于 encoding/gob 的编解码，事件的具体类型需要先通过 gob.Register 注册
+func NewGobCodec() Codec {
+	return &gobCodec{}
+}
+
+func (c *gobCodec) Encode(event interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gobCodec) Decode(data []byte) (interface{}, error) {
+	var event interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,48 @@
+package ebus
+
+import (
+	"context"
+	"time"
+)
+
+// TimeoutHandler 异步处理器可以实现该接口，为单次处理设置超时时间
+type TimeoutHandler interface {
+	Timeout() time.Duration
+}
+
+// Detach 返回一个保留 ctx 中所有值（trace id、租户、用户等），但不会随 ctx 取消、也没有截止时间的 context
+func Detach(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return detachedContext{parent: ctx}
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// asyncContext 异步处理不受请求生命周期影响，只受处理器自身的超时控制
+func asyncContext(ctx context.Context, handler interface{}) (context.Context, context.CancelFunc) {
+	ctx = Detach(ctx)
+	if th, ok := handler.(TimeoutHandler); ok && th.Timeout() > 0 {
+		return context.WithTimeout(ctx, th.Timeout())
+	}
+	return ctx, func() {}
+}
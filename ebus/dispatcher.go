@@ -6,6 +6,12 @@ type Dispatcher interface {
 	Dispatch(ctx context.Context, event interface{}, subscribers []Subscriber)
 }
 
+// TryDispatcher 分发可能失败的 Dispatcher，Post 会返回 TryDispatch 的错误
+type TryDispatcher interface {
+	Dispatcher
+	TryDispatch(ctx context.Context, event interface{}, subscribers []Subscriber) error
+}
+
 type immediateDispatcher struct{}
 
 func NewImmediateDispatcher() Dispatcher {
@@ -0,0 +1,119 @@
+package ebus
+
+import (
+	"context"
+	"log"
+)
+
+// SubscriberLookup 根据标识查找订阅者，EBus 实现了该接口
+type SubscriberLookup interface {
+	LookupSubscriber(id string) (Subscriber, bool)
+}
+
+// DeadLetterHandler 接收无法解码的日志记录，比如事件类型已经删除或者编解码方式变更
+type DeadLetterHandler func(entry *WALEntry, err error)
+
+// DurableDispatcher 持久化分发器，异步订阅者的事件会先写入本地预写日志再返回，
+// 每个订阅者处理完成后单独确认。DurableDispatcher 不会自动重放，进程重启后
+// 调用方需要在所有订阅者注册完成后调用一次 Replay，未确认的事件才会重新投递
+type DurableDispatcher struct {
+	wal        WAL
+	codec      Codec
+	deadLetter DeadLetterHandler
+}
+
+func NewDurableDispatcher(wal WAL, codec Codec) *DurableDispatcher {
+	return &DurableDispatcher{
+		wal:        wal,
+		codec:      codec,
+		deadLetter: logDeadLetter,
+	}
+}
+
+func logDeadLetter(entry *WALEntry, err error) {
+	log.Printf("ebus: drop undecodable wal entry %d for %v: %v", entry.Id, entry.Subscribers, err)
+}
+
+// SetDeadLetterHandler 重放时无法解码的记录交给 handler 后从日志中移除，默认只打印日志
+func (d *DurableDispatcher) SetDeadLetterHandler(handler DeadLetterHandler) {
+	if handler != nil {
+		d.deadLetter = handler
+	}
+}
+
+// Dispatch 写入日志失败时不做持久化，直接投递
+func (d *DurableDispatcher) Dispatch(ctx context.Context, event interface{}, subscribers []Subscriber) {
+	if err := d.TryDispatch(ctx, event, subscribers); err != nil {
+		NewImmediateDispatcher().Dispatch(ctx, event, subscribers)
+	}
+}
+
+// TryDispatch 写入日志失败时不投递，返回错误
+func (d *DurableDispatcher) TryDispatch(ctx context.Context, event interface{}, subscribers []Subscriber) error {
+	var asyncIds []string
+	for _, sub := range subscribers {
+		if _, ok := sub.(AsyncSubscriber); ok {
+			asyncIds = append(asyncIds, sub.Identifier())
+		}
+	}
+	var entryId uint64
+	if len(asyncIds) > 0 {
+		payload, err := d.codec.Encode(event)
+		if err != nil {
+			return err
+		}
+		if entryId, err = d.wal.Append(payload, asyncIds); err != nil {
+			return err
+		}
+	}
+	for _, sub := range subscribers {
+		if async, ok := sub.(AsyncSubscriber); ok {
+			go d.handle(ctx, entryId, async, event)
+		} else {
+			sub.Dispatch(ctx, event)
+		}
+	}
+	return nil
+}
+
+// Replay 重新投递日志中未确认的事件，需要在所有订阅者注册完成后由调用方调用
+// 找不到的订阅者会保留在日志中，等待下一次重放；无法解码的记录交给 DeadLetterHandler，不影响后面的记录
+func (d *DurableDispatcher) Replay(ctx context.Context, lookup SubscriberLookup) error {
+	entries, err := d.wal.Pending()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		event, err := d.codec.Decode(entry.Payload)
+		if err != nil {
+			d.deadLetter(entry, err)
+			for _, id := range entry.Subscribers {
+				_ = d.wal.Ack(entry.Id, id)
+			}
+			continue
+		}
+		for _, id := range entry.Subscribers {
+			sub, ok := lookup.LookupSubscriber(id)
+			if !ok {
+				continue
+			}
+			if async, ok := sub.(AsyncSubscriber); ok {
+				go d.handle(ctx, entry.Id, async, event)
+			} else {
+				sub.Dispatch(ctx, event)
+				_ = d.wal.Ack(entry.Id, id)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *DurableDispatcher) Close() error {
+	return d.wal.Close()
+}
+
+func (d *DurableDispatcher) handle(ctx context.Context, entryId uint64, sub AsyncSubscriber, event interface{}) {
+	sub.Handle(ctx, event)
+	// 确认失败只会导致重放时重复处理
+	_ = d.wal.Ack(entryId, sub.Identifier())
+}
@@ -9,11 +9,24 @@ type EBus interface {
 	Post(ctx context.Context, topic string, event interface{}) error
 	Register(handler EventHandler, topic ...string) error
 	RegisterAsync(handler EventHandler, topic ...string) error
-	Unregister(handler EventHandler, topic ...string)
+	// RegisterFiltered 同步订阅满足 predicate 的事件
+	RegisterFiltered(handler EventHandler, predicate Predicate, topic ...string) error
+	// RegisterAsyncFiltered 异步订阅满足 predicate 的事件
+	RegisterAsyncFiltered(handler EventHandler, predicate Predicate, topic ...string) error
+	RegisterBatch(handler BatchEventHandler, policy BatchPolicy, topic ...string) error
+	Unregister(handler Identifiable, topic ...string)
+	// LookupSubscriber 根据订阅者标识查找订阅者，用于重放持久化的事件
+	LookupSubscriber(id string) (Subscriber, bool)
+	// Close 关闭事件总线，批量订阅者缓冲中的事件会在返回前处理完
+	Close()
+}
+
+type Identifiable interface {
+	Identifier() string
 }
 
 type EventHandler interface {
-	Identifier() string
+	Identifiable
 	OnEvent(ctx context.Context, event interface{})
 }
 
@@ -25,6 +38,7 @@ type bus struct {
 	dispatcher Dispatcher
 	topics     map[string]*SubscriberRegistry
 	lock       sync.RWMutex
+	closed     bool
 }
 
 func NewEBus(opt ...Option) EBus {
@@ -57,7 +71,13 @@ func (b *bus) loadOrStoreRegistry(topic string) *SubscriberRegistry {
 }
 
 func (b *bus) Post(ctx context.Context, topic string, event interface{}) error {
+	if b.isClosed() {
+		return ErrBusClosed
+	}
 	if subscribers, ok := b.loadRegistry(topic); ok {
+		if dispatcher, ok := b.dispatcher.(TryDispatcher); ok {
+			return dispatcher.TryDispatch(ctx, event, subscribers.GetSubscribers(event))
+		}
 		b.dispatcher.Dispatch(ctx, event, subscribers.GetSubscribers(event))
 		return nil
 	} else {
@@ -66,32 +86,52 @@ func (b *bus) Post(ctx context.Context, topic string, event interface{}) error {
 }
 
 func (b *bus) Register(handler EventHandler, topics ...string) error {
+	return b.register(handler, false, nil, topics)
+}
+
+func (b *bus) RegisterAsync(handler EventHandler, topics ...string) error {
+	return b.register(handler, true, nil, topics)
+}
+
+func (b *bus) RegisterFiltered(handler EventHandler, predicate Predicate, topics ...string) error {
+	return b.register(handler, false, predicate, topics)
+}
+
+func (b *bus) RegisterAsyncFiltered(handler EventHandler, predicate Predicate, topics ...string) error {
+	return b.register(handler, true, predicate, topics)
+}
+
+func (b *bus) register(handler EventHandler, async bool, predicate Predicate, topics []string) error {
 	if len(topics) == 0 {
 		return ErrRegisterTopicNotSet
 	}
+	var predicates []Predicate
+	if predicate != nil {
+		predicates = append(predicates, predicate)
+	}
 	for _, topic := range topics {
 		subscribers := b.loadOrStoreRegistry(topic)
-		if err := subscribers.Register(handler, false); err != nil {
+		if err := subscribers.Register(handler, async, predicates...); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (b *bus) RegisterAsync(handler EventHandler, topics ...string) error {
+func (b *bus) RegisterBatch(handler BatchEventHandler, policy BatchPolicy, topics ...string) error {
 	if len(topics) == 0 {
 		return ErrRegisterTopicNotSet
 	}
 	for _, topic := range topics {
 		subscribers := b.loadOrStoreRegistry(topic)
-		if err := subscribers.Register(handler, true); err != nil {
+		if err := subscribers.RegisterBatch(handler, policy); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (b *bus) Unregister(handler EventHandler, topics ...string) {
+func (b *bus) Unregister(handler Identifiable, topics ...string) {
 	if len(topics) == 0 {
 		return
 	}
@@ -102,6 +142,41 @@ func (b *bus) Unregister(handler EventHandler, topics ...string) {
 	}
 }
 
+func (b *bus) LookupSubscriber(id string) (Subscriber, bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for _, registry := range b.topics {
+		if sub, ok := registry.GetSubscriber(id); ok {
+			return sub, true
+		}
+	}
+	return nil, false
+}
+
+func (b *bus) Close() {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	b.closed = true
+	registries := make([]*SubscriberRegistry, 0, len(b.topics))
+	for _, registry := range b.topics {
+		registries = append(registries, registry)
+	}
+	b.lock.Unlock()
+
+	for _, registry := range registries {
+		registry.Close()
+	}
+}
+
+func (b *bus) isClosed() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.closed
+}
+
 var (
 	defaultBus EBus
 	once       sync.Once
@@ -116,6 +191,11 @@ func getDefaultBus() EBus {
 	return defaultBus
 }
 
+// Default 返回包级别函数使用的默认事件总线
+func Default() EBus {
+	return getDefaultBus()
+}
+
 func Post(ctx context.Context, topic string, event interface{}) error {
 	return getDefaultBus().Post(ctx, topic, event)
 }
@@ -128,6 +208,26 @@ func RegisterAsync(handler EventHandler, topic ...string) error {
 	return getDefaultBus().RegisterAsync(handler, topic...)
 }
 
-func Unregister(handler EventHandler, topic ...string) {
+func RegisterFiltered(handler EventHandler, predicate Predicate, topic ...string) error {
+	return getDefaultBus().RegisterFiltered(handler, predicate, topic...)
+}
+
+func RegisterAsyncFiltered(handler EventHandler, predicate Predicate, topic ...string) error {
+	return getDefaultBus().RegisterAsyncFiltered(handler, predicate, topic...)
+}
+
+func RegisterBatch(handler BatchEventHandler, policy BatchPolicy, topic ...string) error {
+	return getDefaultBus().RegisterBatch(handler, policy, topic...)
+}
+
+func Unregister(handler Identifiable, topic ...string) {
 	getDefaultBus().Unregister(handler, topic...)
 }
+
+func LookupSubscriber(id string) (Subscriber, bool) {
+	return getDefaultBus().LookupSubscriber(id)
+}
+
+func Close() {
+	getDefaultBus().Close()
+}
@@ -6,4 +6,5 @@ var (
 	ErrTopicNotFound               = errors.New("topic not found")
 	ErrRegisterTopicNotSet         = errors.New("register topic not set")
 	ErrSubscriberAlreadyRegistered = errors.New("subscriber already registered")
+	ErrBusClosed                   = errors.New("bus closed")
 )
@@ -0,0 +1,165 @@
+package ebus
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Predicate 注册订阅时声明的事件过滤条件，返回 true 表示事件需要投递给该订阅者
+type Predicate func(event interface{}) bool
+
+func And(predicates ...Predicate) Predicate {
+	return func(event interface{}) bool {
+		for _, p := range predicates {
+			if p != nil && !p(event) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func Or(predicates ...Predicate) Predicate {
+	return func(event interface{}) bool {
+		for _, p := range predicates {
+			if p != nil && p(event) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func Not(predicate Predicate) Predicate {
+	return func(event interface{}) bool {
+		return !predicate(event)
+	}
+}
+
+// OfType 事件的具体类型与 sample 相同
+func OfType(sample interface{}) Predicate {
+	t := reflect.TypeOf(sample)
+	return func(event interface{}) bool {
+		return reflect.TypeOf(event) == t
+	}
+}
+
+// FieldMatch 按属性路径取出事件上的值交给 fn 判断，路径用 . 分隔，
+// 每一段可以是结构体字段名、json tag 名或者 map 的 key，属性不存在时不匹配
+func FieldMatch(path string, fn func(value interface{}) bool) Predicate {
+	segments := strings.Split(path, ".")
+	return func(event interface{}) bool {
+		v, ok := lookupField(reflect.ValueOf(event), segments)
+		if !ok {
+			return false
+		}
+		return fn(v.Interface())
+	}
+}
+
+// FieldEquals 事件属性等于 value，数字和字符串类型会先转换成属性的类型再比较
+func FieldEquals(path string, value interface{}) Predicate {
+	return FieldIn(path, value)
+}
+
+// FieldIn 事件属性等于 values 中的任意一个
+func FieldIn(path string, values ...interface{}) Predicate {
+	return FieldMatch(path, func(fieldValue interface{}) bool {
+		for _, value := range values {
+			if looseEqual(fieldValue, value) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func lookupField(v reflect.Value, segments []string) (reflect.Value, bool) {
+	for _, segment := range segments {
+		v = indirect(v)
+		if !v.IsValid() {
+			return v, false
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := structField(v, segment)
+			if !ok {
+				return field, false
+			}
+			v = field
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, false
+			}
+			v = v.MapIndex(reflect.ValueOf(segment).Convert(v.Type().Key()))
+			if !v.IsValid() {
+				return v, false
+			}
+		default:
+			return reflect.Value{}, false
+		}
+	}
+	v = indirect(v)
+	return v, v.IsValid() && v.CanInterface()
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	if field := v.FieldByName(name); field.IsValid() {
+		return field, true
+	}
+	t := v.Type()
+	for i, n := 0, t.NumField(); i < n; i++ {
+		tag := t.Field(i).Tag.Get("json")
+		if idx := strings.Index(tag, ","); idx != -1 {
+			tag = tag[:idx]
+		}
+		if tag == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func looseEqual(fieldValue, value interface{}) bool {
+	if reflect.DeepEqual(fieldValue, value) {
+		return true
+	}
+	fv := reflect.ValueOf(fieldValue)
+	v := reflect.ValueOf(value)
+	if !fv.IsValid() || !v.IsValid() || !isScalarKind(fv.Kind()) || !isScalarKind(v.Kind()) {
+		return false
+	}
+	if (fv.Kind() == reflect.String) != (v.Kind() == reflect.String) {
+		return false
+	}
+	if !v.Type().ConvertibleTo(fv.Type()) {
+		return false
+	}
+	converted := v.Convert(fv.Type())
+	// 避免 1.5 转换成 int 之后等于 1 这类精度丢失的误判
+	if converted.Convert(v.Type()).Interface() != v.Interface() {
+		return false
+	}
+	return converted.Interface() == fv.Interface()
+}
+
+func isScalarKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -13,6 +13,12 @@ type Subscriber interface {
 	Dispatch(ctx context.Context, event interface{})
 }
 
+// AsyncSubscriber 异步订阅者，Handle 在当前协程内完成处理，供需要感知处理结果的分发器使用
+type AsyncSubscriber interface {
+	Subscriber
+	Handle(ctx context.Context, event interface{})
+}
+
 type SubscriberRegistry struct {
 	subscribers *list.List
 	idMap       map[string]*list.Element
@@ -42,7 +48,18 @@ func (s *SubscriberRegistry) GetSubscribers(event interface{}) []Subscriber {
 	return rlt
 }
 
-func (s *SubscriberRegistry) Register(handler EventHandler, async bool) error {
+func (s *SubscriberRegistry) GetSubscriber(id string) (Subscriber, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if ele, ok := s.idMap[id]; ok {
+		return ele.Value.(Subscriber), true
+	}
+	return nil, false
+}
+
+// Register 注册订阅者，predicates 全部满足的事件才会投递给该订阅者
+func (s *SubscriberRegistry) Register(handler EventHandler, async bool, predicates ...Predicate) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
@@ -50,41 +67,96 @@ func (s *SubscriberRegistry) Register(handler EventHandler, async bool) error {
 	if _, ok := s.idMap[key]; ok {
 		return ErrSubscriberAlreadyRegistered
 	}
+	var predicate Predicate
+	if len(predicates) > 0 {
+		predicate = And(predicates...)
+	}
 	var subscriber Subscriber
 	if async {
-		subscriber = newAsyncSubscriber(handler)
+		subscriber = newAsyncSubscriber(handler, predicate)
 	} else {
-		subscriber = newSyncSubscriber(handler)
+		subscriber = newSyncSubscriber(handler, predicate)
 	}
 	ele := s.subscribers.PushBack(subscriber)
 	s.idMap[key] = ele
 	return nil
 }
 
-func (s *SubscriberRegistry) Unregister(handler EventHandler) {
+func (s *SubscriberRegistry) RegisterBatch(handler BatchEventHandler, policy BatchPolicy) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
 	key := subscriberIdentifier(handler)
-	if ele, ok := s.idMap[key]; ok {
+	if _, ok := s.idMap[key]; ok {
+		return ErrSubscriberAlreadyRegistered
+	}
+	ele := s.subscribers.PushBack(newBatchSubscriber(handler, policy))
+	s.idMap[key] = ele
+	return nil
+}
+
+// Unregister 在锁内摘除订阅者，在锁外关闭，关闭时会等待批量订阅者处理完缓冲的事件
+func (s *SubscriberRegistry) Unregister(handler Identifiable) {
+	s.lock.Lock()
+	key := subscriberIdentifier(handler)
+	ele, ok := s.idMap[key]
+	if ok {
 		s.subscribers.Remove(ele)
 		delete(s.idMap, key)
 	}
+	s.lock.Unlock()
+
+	if ok {
+		closeSubscriber(ele.Value.(Subscriber))
+	}
+}
+
+// Close 关闭所有需要释放资源的订阅者，比如批量订阅者会把缓冲的事件处理完
+func (s *SubscriberRegistry) Close() {
+	s.lock.RLock()
+	subscribers := make([]Subscriber, 0, s.subscribers.Len())
+	for ele := s.subscribers.Front(); ele != nil; ele = ele.Next() {
+		subscribers = append(subscribers, ele.Value.(Subscriber))
+	}
+	s.lock.RUnlock()
+
+	for _, sub := range subscribers {
+		closeSubscriber(sub)
+	}
+}
+
+func closeSubscriber(sub Subscriber) {
+	if c, ok := sub.(interface{ Close() }); ok {
+		c.Close()
+	}
+}
+
+// filterEvent 返回 true 表示事件需要被过滤掉
+func filterEvent(handler interface{}, predicate Predicate, event interface{}) bool {
+	if predicate != nil && !predicate(event) {
+		return true
+	}
+	if f, ok := handler.(EventFilter); ok {
+		return f.Filter(event)
+	}
+	return false
 }
 
-func subscriberIdentifier(handler EventHandler) string {
+func subscriberIdentifier(handler Identifiable) string {
 	return fmt.Sprintf("subscriber-%s", handler.Identifier())
 }
 
 type syncSubscriber struct {
 	identifier string
 	handler    EventHandler
+	predicate  Predicate
 }
 
-func newSyncSubscriber(handler EventHandler) Subscriber {
+func newSyncSubscriber(handler EventHandler, predicate Predicate) Subscriber {
 	return &syncSubscriber{
 		identifier: subscriberIdentifier(handler),
 		handler:    handler,
+		predicate:  predicate,
 	}
 }
 
@@ -93,10 +165,7 @@ func (s *syncSubscriber) Identifier() string {
 }
 
 func (s *syncSubscriber) Filter(event interface{}) bool {
-	if f, ok := s.handler.(EventFilter); ok {
-		return f.Filter(event)
-	}
-	return false
+	return filterEvent(s.handler, s.predicate, event)
 }
 
 func (s *syncSubscriber) Dispatch(ctx context.Context, event interface{}) {
@@ -106,12 +175,14 @@ func (s *syncSubscriber) Dispatch(ctx context.Context, event interface{}) {
 type asyncSubscriber struct {
 	identifier string
 	handler    EventHandler
+	predicate  Predicate
 }
 
-func newAsyncSubscriber(handler EventHandler) Subscriber {
+func newAsyncSubscriber(handler EventHandler, predicate Predicate) Subscriber {
 	return &asyncSubscriber{
 		identifier: subscriberIdentifier(handler),
 		handler:    handler,
+		predicate:  predicate,
 	}
 }
 
@@ -120,14 +191,15 @@ func (s *asyncSubscriber) Identifier() string {
 }
 
 func (s *asyncSubscriber) Filter(event interface{}) bool {
-	if f, ok := s.handler.(EventFilter); ok {
-		return f.Filter(event)
-	}
-	return false
+	return filterEvent(s.handler, s.predicate, event)
 }
 
 func (s *asyncSubscriber) Dispatch(ctx context.Context, event interface{}) {
-	go func() {
-		s.handler.OnEvent(ctx, event)
-	}()
+	go s.Handle(ctx, event)
+}
+
+func (s *asyncSubscriber) Handle(ctx context.Context, event interface{}) {
+	ctx, cancel := asyncContext(ctx, s.handler)
+	defer cancel()
+	s.handler.OnEvent(ctx, event)
 }
@@ -0,0 +1,53 @@
+package ebus
+
+import (
+	"context"
+)
+
+// TypedEventHandler 强类型事件处理函数
+type TypedEventHandler[T any] func(ctx context.Context, event T)
+
+type typedHandler[T any] struct {
+	id string
+	fn TypedEventHandler[T]
+}
+
+func (h *typedHandler[T]) Identifier() string {
+	return h.id
+}
+
+// Filter 过滤掉类型不是 T 的事件，同一个 topic 上可以有多种事件类型
+func (h *typedHandler[T]) Filter(event interface{}) bool {
+	_, ok := event.(T)
+	return !ok
+}
+
+func (h *typedHandler[T]) OnEvent(ctx context.Context, event interface{}) {
+	h.fn(ctx, event.(T))
+}
+
+// Subscribe 同步订阅类型为 T 的事件
+func Subscribe[T any](b EBus, id string, fn TypedEventHandler[T], topic ...string) error {
+	return b.Register(&typedHandler[T]{id: id, fn: fn}, topic...)
+}
+
+// SubscribeAsync 异步订阅类型为 T 的事件
+func SubscribeAsync[T any](b EBus, id string, fn TypedEventHandler[T], topic ...string) error {
+	return b.RegisterAsync(&typedHandler[T]{id: id, fn: fn}, topic...)
+}
+
+// Unsubscribe 取消 Subscribe/SubscribeAsync 注册的订阅
+func Unsubscribe(b EBus, id string, topic ...string) {
+	b.Unregister(handlerId(id), topic...)
+}
+
+type handlerId string
+
+func (h handlerId) Identifier() string {
+	return string(h)
+}
+
+// Publish 发布类型为 T 的事件
+func Publish[T any](ctx context.Context, b EBus, topic string, event T) error {
+	return b.Post(ctx, topic, event)
+}
@@ -0,0 +1,255 @@
+package ebus
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// WALEntry 预写日志中的一条事件记录
+type WALEntry struct {
+	Id      uint64
+	Payload []byte
+	// Subscribers 尚未确认处理完成的订阅者
+	Subscribers []string
+}
+
+// WAL 本地预写日志，记录事件以及每个订阅者的确认情况
+type WAL interface {
+	// Append 写入事件，返回前必须已经落盘
+	Append(payload []byte, subscribers []string) (uint64, error)
+	// Ack 确认某个订阅者已经处理完成
+	Ack(id uint64, subscriber string) error
+	// Pending 返回还有订阅者未确认的事件，按写入顺序排列
+	Pending() ([]*WALEntry, error)
+	Close() error
+}
+
+const (
+	walOpAppend = "append"
+	walOpAck    = "ack"
+
+	// 已经确认完成的记录数超过该值时重写文件，只保留未确认的事件
+	walCompactThreshold = 1024
+)
+
+type walRecord struct {
+	Op          string   `json:"op"`
+	Id          uint64   `json:"id"`
+	Payload     []byte   `json:"payload,omitempty"`
+	Subscribers []string `json:"subs,omitempty"`
+	Subscriber  string   `json:"sub,omitempty"`
+}
+
+type fileWAL struct {
+	path    string
+	file    *os.File
+	lastId  uint64
+	records int
+	pending map[uint64]*WALEntry
+	lock    sync.Mutex
+}
+
+// NewFileWAL 基于本地文件的预写日志，每行一条 JSON 记录，打开时会重建未确认的事件并压缩文件
+func NewFileWAL(path string) (WAL, error) {
+	w := &fileWAL{
+		path:    path,
+		pending: make(map[uint64]*WALEntry),
+	}
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	if err := w.rewrite(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *fileWAL) load() error {
+	f, err := os.Open(w.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var record walRecord
+			// 进程崩溃时最后一行可能没有写完整，直接忽略
+			if json.Unmarshal(line, &record) == nil {
+				w.apply(&record)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (w *fileWAL) apply(record *walRecord) {
+	if record.Id > w.lastId {
+		w.lastId = record.Id
+	}
+	switch record.Op {
+	case walOpAppend:
+		if len(record.Subscribers) == 0 {
+			return
+		}
+		w.pending[record.Id] = &WALEntry{
+			Id:          record.Id,
+			Payload:     record.Payload,
+			Subscribers: record.Subscribers,
+		}
+	case walOpAck:
+		entry, ok := w.pending[record.Id]
+		if !ok {
+			return
+		}
+		for idx, sub := range entry.Subscribers {
+			if sub == record.Subscriber {
+				entry.Subscribers = append(entry.Subscribers[:idx:idx], entry.Subscribers[idx+1:]...)
+				break
+			}
+		}
+		if len(entry.Subscribers) == 0 {
+			delete(w.pending, record.Id)
+		}
+	}
+}
+
+// rewrite 只保留未确认的事件重写日志文件，失败时继续使用原来的文件
+func (w *fileWAL) rewrite() error {
+	tmpPath := w.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	for _, entry := range w.sortedPending() {
+		if err = writeWALRecord(writer, &walRecord{
+			Op:          walOpAppend,
+			Id:          entry.Id,
+			Payload:     entry.Payload,
+			Subscribers: entry.Subscribers,
+		}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err = writer.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// 重命名前打开新文件，重命名后句柄仍然指向它；任何一步失败都不替换原来的句柄
+	file, err := os.OpenFile(tmpPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, w.path); err != nil {
+		file.Close()
+		return err
+	}
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file = file
+	w.records = len(w.pending)
+	return nil
+}
+
+func (w *fileWAL) sortedPending() []*WALEntry {
+	rlt := make([]*WALEntry, 0, len(w.pending))
+	for _, entry := range w.pending {
+		rlt = append(rlt, entry)
+	}
+	sort.Slice(rlt, func(i, j int) bool {
+		return rlt[i].Id < rlt[j].Id
+	})
+	return rlt
+}
+
+func (w *fileWAL) Append(payload []byte, subscribers []string) (uint64, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	id := w.lastId + 1
+	record := &walRecord{
+		Op:          walOpAppend,
+		Id:          id,
+		Payload:     payload,
+		Subscribers: append([]string(nil), subscribers...),
+	}
+	if err := writeWALRecord(w.file, record); err != nil {
+		return 0, err
+	}
+	if err := w.file.Sync(); err != nil {
+		return 0, err
+	}
+	w.records++
+	w.apply(record)
+	return id, nil
+}
+
+func (w *fileWAL) Ack(id uint64, subscriber string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if _, ok := w.pending[id]; !ok {
+		return nil
+	}
+	// 确认记录不强制刷盘，丢失只会导致重复处理
+	record := &walRecord{Op: walOpAck, Id: id, Subscriber: subscriber}
+	if err := writeWALRecord(w.file, record); err != nil {
+		return err
+	}
+	w.records++
+	w.apply(record)
+	if w.records-len(w.pending) > walCompactThreshold {
+		return w.rewrite()
+	}
+	return nil
+}
+
+func (w *fileWAL) Pending() ([]*WALEntry, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	rlt := w.sortedPending()
+	for idx, entry := range rlt {
+		copied := *entry
+		copied.Subscribers = append([]string(nil), entry.Subscribers...)
+		rlt[idx] = &copied
+	}
+	return rlt, nil
+}
+
+func (w *fileWAL) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.file.Close()
+}
+
+func writeWALRecord(writer io.Writer, record *walRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,211 @@
+package ebus
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type walTestEvent struct {
+	Name string
+}
+
+func init() {
+	gob.Register(walTestEvent{})
+}
+
+type walTestHandler struct {
+	id     string
+	events chan interface{}
+}
+
+func (h *walTestHandler) Identifier() string {
+	return h.id
+}
+
+func (h *walTestHandler) OnEvent(ctx context.Context, event interface{}) {
+	h.events <- event
+}
+
+func openWAL(t *testing.T, path string) *fileWAL {
+	t.Helper()
+	w, err := NewFileWAL(path)
+	if err != nil {
+		t.Fatalf("NewFileWAL: %v", err)
+	}
+	return w.(*fileWAL)
+}
+
+func pendingSubscribers(t *testing.T, w WAL) map[uint64][]string {
+	t.Helper()
+	entries, err := w.Pending()
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	rlt := make(map[uint64][]string)
+	for _, entry := range entries {
+		rlt[entry.Id] = entry.Subscribers
+	}
+	return rlt
+}
+
+func TestFileWALRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.wal")
+	w := openWAL(t, path)
+	for i := 0; i < 3; i++ {
+		if _, err := w.Append([]byte("payload"), []string{"a", "b"}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	for _, ack := range []struct {
+		id  uint64
+		sub string
+	}{{1, "a"}, {1, "b"}, {2, "a"}} {
+		if err := w.Ack(ack.id, ack.sub); err != nil {
+			t.Fatalf("Ack: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// 模拟崩溃时写了一半的记录
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.WriteString(`{"op":"ack","id":3`)
+	f.Close()
+
+	w = openWAL(t, path)
+	defer w.Close()
+	want := map[uint64][]string{2: {"b"}, 3: {"a", "b"}}
+	if got := pendingSubscribers(t, w); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Pending after restart = %v, want %v", got, want)
+	}
+	id, err := w.Append([]byte("payload"), []string{"a"})
+	if err != nil || id != 4 {
+		t.Fatalf("Append after restart = %d, %v, want 4", id, err)
+	}
+}
+
+func TestFileWALCompactUnderLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.wal")
+	w := openWAL(t, path)
+	defer w.Close()
+	// 始终保留一个未确认的事件，模拟持续有事件在处理中
+	prev, _ := w.Append([]byte("payload"), []string{"a"})
+	for i := 0; i < 2*walCompactThreshold; i++ {
+		id, err := w.Append([]byte("payload"), []string{"a"})
+		if err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+		if err = w.Ack(prev, "a"); err != nil {
+			t.Fatalf("Ack: %v", err)
+		}
+		prev = id
+	}
+	if w.records > walCompactThreshold+1 {
+		t.Fatalf("records = %d, log was not compacted", w.records)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := bytes.Count(data, []byte("\n")); lines > walCompactThreshold+1 {
+		t.Fatalf("wal has %d lines, log was not compacted", lines)
+	}
+	if got := pendingSubscribers(t, w); len(got) != 1 || got[prev] == nil {
+		t.Fatalf("Pending = %v, want only %d", got, prev)
+	}
+}
+
+func TestFileWALRewriteFailureKeepsHandle(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.wal")
+	w := openWAL(t, path)
+	defer w.Close()
+	// 日志文件的位置被非空目录占用，重命名失败
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "occupied"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.rewrite(); err == nil {
+		t.Fatal("rewrite should fail")
+	}
+	if _, err := w.Append([]byte("payload"), []string{"a"}); err != nil {
+		t.Fatalf("Append after failed rewrite: %v", err)
+	}
+}
+
+func TestDurableDispatcherReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.wal")
+	codec := NewGobCodec()
+	handler := &walTestHandler{id: "handler", events: make(chan interface{}, 1)}
+	subscriberId := subscriberIdentifier(handler)
+	w := openWAL(t, path)
+	// 上一个进程写入日志后崩溃，没有确认
+	if _, err := w.Append([]byte("broken"), []string{subscriberId}); err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := codec.Encode(walTestEvent{Name: "created"})
+	if _, err := w.Append(payload, []string{subscriberId}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	w = openWAL(t, path)
+	dispatcher := NewDurableDispatcher(w, codec)
+	defer dispatcher.Close()
+	var deadLetters []uint64
+	dispatcher.SetDeadLetterHandler(func(entry *WALEntry, err error) {
+		deadLetters = append(deadLetters, entry.Id)
+	})
+	bus := NewEBus(WithDispatcher(dispatcher))
+	if err := bus.RegisterAsync(handler, "topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.Replay(context.Background(), bus); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	select {
+	case event := <-handler.events:
+		if event != (walTestEvent{Name: "created"}) {
+			t.Fatalf("replayed %v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event was not replayed")
+	}
+	if !reflect.DeepEqual(deadLetters, []uint64{1}) {
+		t.Fatalf("dead letters = %v, want [1]", deadLetters)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(pendingSubscribers(t, w)) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Pending after replay = %v", pendingSubscribers(t, w))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type failingWAL struct {
+	WAL
+}
+
+func (f failingWAL) Append(payload []byte, subscribers []string) (uint64, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestDurableDispatcherPostError(t *testing.T) {
+	dispatcher := NewDurableDispatcher(failingWAL{}, NewGobCodec())
+	bus := NewEBus(WithDispatcher(dispatcher))
+	handler := &walTestHandler{id: "handler", events: make(chan interface{}, 1)}
+	if err := bus.RegisterAsync(handler, "topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Post(context.Background(), "topic", walTestEvent{}); err == nil {
+		t.Fatal("Post should return the WAL error")
+	}
+}
@@ -65,6 +65,27 @@ func DeepCopy(src interface{}) interface{} {
 	return dst.Addr().Interface()
 }
 
+// DeepCopyOf 深拷贝 v，返回与 v 相同的类型；T 为接口且 v 为 nil 时返回 nil
+func DeepCopyOf[T any](v T) T {
+	src := reflect.ValueOf(&v).Elem()
+	dst := reflect.New(src.Type()).Elem()
+	copyRecursive(src, dst)
+	rlt, _ := dst.Interface().(T)
+	return rlt
+}
+
+// CopyMap 复制 map，值不会被深拷贝；m 为 nil 时返回 nil
+func CopyMap[M ~map[K]V, K comparable, V any](m M) M {
+	if m == nil {
+		return nil
+	}
+	rlt := make(M, len(m))
+	for k, v := range m {
+		rlt[k] = v
+	}
+	return rlt
+}
+
 func copyRecursive(original, cpy reflect.Value) {
 	// handle according to original's Kind
 	switch original.Kind() {
@@ -128,8 +149,9 @@ func copyRecursive(original, cpy reflect.Value) {
 			originalValue := original.MapIndex(key)
 			copyValue := reflect.New(originalValue.Type()).Elem()
 			copyRecursive(originalValue, copyValue)
-			copyKey := DeepCopy(key.Interface())
-			cpy.SetMapIndex(reflect.ValueOf(copyKey), copyValue)
+			copyKey := reflect.New(key.Type()).Elem()
+			copyRecursive(key, copyKey)
+			cpy.SetMapIndex(copyKey, copyValue)
 		}
 
 	default:
@@ -1,8 +1,13 @@
 module github.com/zhenyu888/ddd-core
 
-go 1.14
+go 1.18
 
 require (
 	github.com/pkg/errors v0.9.1
 	gorm.io/gorm v1.23.6
 )
+
+require (
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.4 // indirect
+)